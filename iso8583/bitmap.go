@@ -0,0 +1,133 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+// BitmapEncoding tells how bitmaps are represented on the wire
+type BitmapEncoding int
+
+// Supported bitmap encodings
+const (
+	BitmapBinary    BitmapEncoding = iota // 8 raw bytes per bitmap
+	BitmapHex                             // 16 ASCII hex characters per bitmap
+	BitmapEBCDICHex                       // 16 EBCDIC hex characters per bitmap
+)
+
+const hexDigits = "0123456789ABCDEF"
+
+// blockSize returns the wire size of one 64 bit bitmap
+func (e BitmapEncoding) blockSize() int {
+	if e == BitmapBinary {
+		return 8
+	}
+	return 16
+}
+
+// encode packs 64 bits into one wire bitmap
+func (e BitmapEncoding) encode(bits []bool) []byte {
+	raw := make([]byte, 8)
+	for i, set := range bits {
+		if set {
+			raw[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	if e == BitmapBinary {
+		return raw
+	}
+
+	buf := make([]byte, 16)
+	for i, b := range raw {
+		buf[2*i] = hexDigits[b>>4]
+		buf[2*i+1] = hexDigits[b&0x0F]
+	}
+	if e == BitmapEBCDICHex {
+		for i, c := range buf {
+			buf[i] = ebcdicHex(c)
+		}
+	}
+	return buf
+}
+
+// decode unpacks one wire bitmap into 64 bits
+func (e BitmapEncoding) decode(buf []byte, bits []bool) error {
+	raw := buf
+	if e != BitmapBinary {
+		raw = make([]byte, 8)
+		for i, c := range buf {
+			if e == BitmapEBCDICHex {
+				c = asciiHex(c)
+			}
+			v := hexValue(c)
+			if v < 0 {
+				return ErrBadBitmap
+			}
+			raw[i/2] = raw[i/2]<<4 | byte(v)
+		}
+	}
+
+	for i := range bits {
+		bits[i] = raw[i/8]&(0x80>>uint(i%8)) != 0
+	}
+	return nil
+}
+
+func hexValue(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'A' <= c && c <= 'F':
+		return int(c-'A') + 10
+	case 'a' <= c && c <= 'f':
+		return int(c-'a') + 10
+	}
+	return -1
+}
+
+// ebcdicHex converts an ASCII hex digit to EBCDIC
+func ebcdicHex(c byte) byte {
+	if c <= '9' {
+		return 0xF0 + c - '0'
+	}
+	return 0xC1 + c - 'A'
+}
+
+// asciiHex converts an EBCDIC hex digit to ASCII, other bytes are
+// mapped to an invalid digit
+func asciiHex(c byte) byte {
+	switch {
+	case 0xF0 <= c && c <= 0xF9:
+		return '0' + c - 0xF0
+	case 0xC1 <= c && c <= 0xC6:
+		return 'A' + c - 0xC1
+	case 0x81 <= c && c <= 0x86:
+		return 'a' + c - 0x81
+	}
+	return 0
+}
+
+// bitmapBlocks returns the number of bitmaps needed for m and sets the
+// secondary (bit 1) and tertiary (bit 65) indicators accordingly
+func (m *Iso8583Message) bitmapBlocks() int {
+	m.Bitmap[64] = false
+	for i := 128; i < MaxField; i++ {
+		if m.Bitmap[i] {
+			m.Bitmap[64] = true
+			break
+		}
+	}
+
+	m.Bitmap[0] = false
+	for i := 64; i < 128; i++ {
+		if m.Bitmap[i] {
+			m.Bitmap[0] = true
+			break
+		}
+	}
+
+	switch {
+	case m.Bitmap[64]:
+		return 3
+	case m.Bitmap[0]:
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,66 @@
+package iso8583
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestBitmapEncodings(t *testing.T) {
+	tests := []struct {
+		enc    BitmapEncoding
+		bitmap []byte
+	}{
+		{BitmapBinary, []byte{0xF0, 0x20, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{BitmapHex, []byte("F020000000000000")},
+		{BitmapEBCDICHex, []byte{0xC6, 0xF0, 0xF2, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0}},
+	}
+
+	for _, tt := range tests {
+		spec := DefaultSpec()
+		spec.Bitmap = tt.enc
+		spec.SetField(150, &LLField{Type: "ans..", Length: 20})
+
+		msg := new(Iso8583Message)
+		msg.Mti = "0200"
+		msg.Set(CardNo, "4111111111111111")
+		msg.Set(ProcCode, "1")
+		msg.Set(AMOUNT, "100")
+		msg.Set(TraceNo, "1")
+		msg.Set(150, "tertiary")
+
+		var buf bytes.Buffer
+		if err := msg.Serialize(spec, &buf); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		if !bytes.Equal(data[4:4+len(tt.bitmap)], tt.bitmap) {
+			t.Errorf("%d: primary bitmap %X, want %X", tt.enc, data[4:4+len(tt.bitmap)], tt.bitmap)
+		}
+		if !msg.Bitmap[0] || !msg.Bitmap[64] {
+			t.Errorf("%d: secondary/tertiary indicators not set", tt.enc)
+		}
+
+		got := new(Iso8583Message)
+		if err := got.Parse(spec, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if got.Get(150) != "tertiary" || got.Get(AMOUNT) != "100" {
+			t.Errorf("%d: got fields 4=%q 150=%q", tt.enc, got.Get(AMOUNT), got.Get(150))
+		}
+		if got.Bitmap != msg.Bitmap {
+			t.Errorf("%d: bitmap mismatch after round trip", tt.enc)
+		}
+	}
+}
+
+func TestBadHexBitmap(t *testing.T) {
+	spec := DefaultSpec()
+	spec.Bitmap = BitmapHex
+
+	err := new(Iso8583Message).Parse(spec, bytes.NewReader([]byte("0200722G000000000000")))
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Field != 1 || fe.Offset != 4 || fe.Err != ErrBadBitmap {
+		t.Errorf("got %v, want field 1 at offset 4: %v", err, ErrBadBitmap)
+	}
+}
@@ -0,0 +1,96 @@
+package iso8583
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// ebcdicSpec is DefaultSpec with every value, length and the MTI in cs
+func ebcdicSpec(cs *Charset) *Spec {
+	spec := DefaultSpec()
+	spec.MtiEnc = cs
+	spec.Bitmap = BitmapEBCDICHex
+	for _, f := range spec.Fields {
+		switch f := f.(type) {
+		case *Field:
+			f.Enc = cs
+		case *LLField:
+			f.Enc, f.LenEnc = cs, cs
+		case *LLLField:
+			f.Enc, f.LenEnc = cs, cs
+		}
+	}
+	return spec
+}
+
+func TestCharsetTables(t *testing.T) {
+	for _, cs := range []*Charset{CP037, CP1047} {
+		all := make([]byte, 256)
+		for i := range all {
+			all[i] = byte(i)
+		}
+		s, _ := cs.Decode(all, len(all))
+		back, err := cs.Encode(s)
+		if err != nil || !bytes.Equal(back, all) {
+			t.Errorf("%s: table does not round trip: %v", cs.Name, err)
+		}
+	}
+
+	tests := []struct {
+		cs   *Charset
+		in   string
+		wire []byte
+	}{
+		{CP037, "AZaz09 ", []byte{0xC1, 0xE9, 0x81, 0xA9, 0xF0, 0xF9, 0x40}},
+		{CP037, "[^]é", []byte{0xBA, 0xB0, 0xBB, 0x51}},
+		{CP1047, "[^]é", []byte{0xAD, 0x5F, 0xBD, 0x51}},
+	}
+	for _, tt := range tests {
+		wire, err := tt.cs.Encode(tt.in)
+		if err != nil || !bytes.Equal(wire, tt.wire) {
+			t.Errorf("%s %q: got %X %v, want %X", tt.cs.Name, tt.in, wire, err, tt.wire)
+		}
+	}
+
+	if _, err := CP037.Encode("€"); err != ErrBadEBCDIC {
+		t.Errorf("got %v, want %v", err, ErrBadEBCDIC)
+	}
+}
+
+func TestEBCDICRoundTrip(t *testing.T) {
+	msg := sampleMessage()
+	msg.Set(DESC, "Café Zürich")
+	msg.Set(AdditionalData, "naïve [x]")
+
+	ascii := new(Iso8583Message)
+	var buf bytes.Buffer
+	if err := msg.Serialize(DefaultSpec(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := ascii.Parse(DefaultSpec(), &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cs := range []*Charset{CP037, CP1047} {
+		spec := ebcdicSpec(cs)
+		buf.Reset()
+		if err := msg.Serialize(spec, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Bytes()[0] != 0xF0 {
+			t.Errorf("%s: MTI not in EBCDIC: %X", cs.Name, buf.Bytes()[:4])
+		}
+
+		got := new(Iso8583Message)
+		if err := got.Parse(spec, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, ascii) {
+			t.Errorf("%s: parsed message differs from ASCII", cs.Name)
+		}
+		if got.Get(DESC) != "Café Zürich" {
+			t.Errorf("%s: field 43 = %q", cs.Name, got.Get(DESC))
+		}
+	}
+}
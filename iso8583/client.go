@@ -0,0 +1,237 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ErrClosed is returned for requests on a closed client
+var ErrClosed = errors.New("iso8583: connection closed")
+
+// Client multiplexes requests over one connection. Responses are matched
+// to their requests by STAN (field 11), and by RRN (field 37) and
+// terminal ID (field 41) when the request carries them, so many requests
+// can be in flight at the same time.
+type Client struct {
+	Spec   *Spec
+	Framer Framer
+	Header []byte // frame header sent with every message, like a TPDU
+
+	// OnUnmatched is called from the read loop for responses nobody
+	// waits for, e.g. those arriving after their request timed out, and
+	// for requests coming from the other side
+	OnUnmatched func(m *Iso8583Message)
+	// OnError is called from the read loop for messages that cannot be
+	// parsed, they are skipped
+	OnError func(err error)
+
+	conn  io.ReadWriteCloser
+	wmu   sync.Mutex // serializes writes
+	start sync.Once
+
+	mu      sync.Mutex
+	pending map[string][]*waiter // by STAN
+	stan    int
+	err     error
+	done    chan struct{}
+}
+
+// NewClient returns a client on conn. Callbacks and Header may be set
+// until the client is started by Start or the first Send or Write.
+func NewClient(conn io.ReadWriteCloser, spec *Spec, framer Framer) *Client {
+	return &Client{
+		Spec:    spec,
+		Framer:  framer,
+		conn:    conn,
+		pending: make(map[string][]*waiter),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start starts reading from the connection. It is only needed when the
+// peer may send before the first Send or Write, calling it again does
+// nothing.
+func (c *Client) Start() {
+	c.start.Do(func() { go c.readLoop() })
+}
+
+// waiter is a request waiting for its response
+type waiter struct {
+	rrn, tid string // fields 37 and 41 of the request, empty if absent
+	ch       chan *Iso8583Message
+}
+
+// matches tells whether resp, with the STAN of the request, answers it.
+// Fields 37 and 41 are only compared when the request carries them, as
+// hosts may add them to responses.
+func (w *waiter) matches(resp *Iso8583Message) bool {
+	return (w.rrn == "" || w.rrn == strings.TrimSpace(resp.Get(RefNo))) &&
+		(w.tid == "" || w.tid == strings.TrimSpace(resp.Get(TERMINAL)))
+}
+
+// NextSTAN returns the next systems trace audit number, 000001-999999
+func (c *Client) NextSTAN() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stan = c.stan%999999 + 1
+	return fmt.Sprintf("%06d", c.stan)
+}
+
+// Send writes req and waits for its response until ctx is done. A STAN
+// is assigned when req has none.
+func (c *Client) Send(ctx context.Context, req *Iso8583Message) (*Iso8583Message, error) {
+	c.Start()
+	if req.Get(TraceNo) == "" {
+		req.Set(TraceNo, c.NextSTAN())
+	}
+	stan := c.Spec.Value(req, TraceNo)
+	w := &waiter{
+		rrn: strings.TrimSpace(req.Get(RefNo)),
+		tid: strings.TrimSpace(req.Get(TERMINAL)),
+		ch:  make(chan *Iso8583Message, 1),
+	}
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	for _, p := range c.pending[stan] {
+		if p.rrn == w.rrn && p.tid == w.tid {
+			c.mu.Unlock()
+			return nil, fmt.Errorf("iso8583: request %s already in flight", stan)
+		}
+	}
+	c.pending[stan] = append(c.pending[stan], w)
+	c.mu.Unlock()
+
+	if err := c.Write(req); err != nil {
+		c.forget(stan, w)
+		return nil, err
+	}
+
+	select {
+	case resp := <-w.ch:
+		return resp, nil
+	case <-ctx.Done():
+		c.forget(stan, w)
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, c.Err()
+	}
+}
+
+// Write sends a message without waiting for a response
+func (c *Client) Write(m *Iso8583Message) error {
+	c.Start()
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return WriteMessage(c.conn, c.Framer, c.Spec, m, c.Header)
+}
+
+func (c *Client) forget(stan string, w *waiter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ws := c.pending[stan]
+	for i := range ws {
+		if ws[i] == w {
+			ws = append(ws[:i], ws[i+1:]...)
+			break
+		}
+	}
+	if len(ws) == 0 {
+		delete(c.pending, stan)
+	} else {
+		c.pending[stan] = ws
+	}
+}
+
+// Close closes the connection, pending requests fail with ErrClosed
+func (c *Client) Close() error {
+	c.Start()
+	err := c.conn.Close()
+	<-c.done
+	return err
+}
+
+// Done is closed when the connection of a started client is gone
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason the connection is gone
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Pending returns the number of requests waiting for a response
+func (c *Client) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, ws := range c.pending {
+		n += len(ws)
+	}
+	return n
+}
+
+func (c *Client) readLoop() {
+	var err error
+	for {
+		var m *Iso8583Message
+		m, _, err = ReadMessage(c.conn, c.Framer, c.Spec)
+		if err != nil {
+			if !isMessageError(err) {
+				// framing or connection failure
+				break
+			}
+			if c.OnError != nil {
+				c.OnError(err)
+			}
+			continue
+		}
+		c.dispatch(m)
+	}
+
+	c.mu.Lock()
+	if err == io.EOF {
+		c.err = ErrClosed
+	} else {
+		c.err = fmt.Errorf("%w: %v", ErrClosed, err)
+	}
+	c.pending = make(map[string][]*waiter)
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// dispatch hands a message read from the connection to its receiver
+func (c *Client) dispatch(m *Iso8583Message) {
+	if m.Mti.IsResponse() {
+		stan := c.Spec.Value(m, TraceNo)
+		var found *waiter
+		c.mu.Lock()
+		for _, w := range c.pending[stan] {
+			if w.matches(m) {
+				found = w
+				break
+			}
+		}
+		c.mu.Unlock()
+		if found != nil {
+			c.forget(stan, found)
+			found.ch <- m
+			return
+		}
+	}
+	if c.OnUnmatched != nil {
+		c.OnUnmatched(m)
+	}
+}
@@ -0,0 +1,158 @@
+package iso8583
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeHost answers requests in reverse order of arrival, per batch of n
+func fakeHost(t *testing.T, conn net.Conn, spec *Spec, framer Framer, n int) {
+	var batch []*Iso8583Message
+	for {
+		m, _, err := ReadMessage(conn, framer, spec)
+		if err != nil {
+			return
+		}
+		batch = append(batch, m)
+		if len(batch) < n {
+			continue
+		}
+		for i := len(batch) - 1; i >= 0; i-- {
+			resp := batch[i]
+			resp.Mti, _ = resp.Mti.Response()
+			resp.Set(ResponseCode, "00")
+			resp.Set(ApprovalCode, resp.Get(TraceNo))
+			if err := WriteMessage(conn, framer, spec, resp, nil); err != nil {
+				t.Error(err)
+			}
+		}
+		batch = nil
+	}
+}
+
+func TestClientMatching(t *testing.T) {
+	spec := DefaultSpec()
+	framer := NewBinaryFramer()
+	local, remote := net.Pipe()
+	go fakeHost(t, remote, spec, framer, 5)
+
+	c := NewClient(local, spec, framer)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := sampleMessage()
+			req.Unset(TraceNo)
+			resp, err := c.Send(context.Background(), req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if resp.Mti != "0210" || resp.Get(ApprovalCode) != strings.TrimLeft(req.Get(TraceNo), "0") {
+				t.Errorf("request %s got response %s for %s", req.Get(TraceNo), resp.Mti, resp.Get(ApprovalCode))
+			}
+		}()
+	}
+	wg.Wait()
+	if c.Pending() != 0 {
+		t.Errorf("%d requests left pending", c.Pending())
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	spec := DefaultSpec()
+	framer := NewBinaryFramer()
+	local, remote := net.Pipe()
+	go fakeHost(t, remote, spec, framer, 2)
+
+	late := make(chan *Iso8583Message, 1)
+	c := NewClient(local, spec, framer)
+	c.OnUnmatched = func(m *Iso8583Message) { late <- m }
+
+	// the host holds the first request until a second one arrives
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req := sampleMessage()
+	if _, err := c.Send(ctx, req); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	second := sampleMessage()
+	second.Set(TraceNo, "124")
+	if _, err := c.Send(context.Background(), second); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-late:
+		if m.Get(TraceNo) != "123" {
+			t.Errorf("late response for STAN %s", m.Get(TraceNo))
+		}
+	case <-time.After(time.Second):
+		t.Error("late response was not reported")
+	}
+
+	c.Close()
+	if _, err := c.Send(context.Background(), sampleMessage()); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestClientAddedFields(t *testing.T) {
+	spec := DefaultSpec()
+	framer := NewBinaryFramer()
+	local, remote := net.Pipe()
+	go func() {
+		for {
+			m, _, err := ReadMessage(remote, framer, spec)
+			if err != nil {
+				return
+			}
+			m.Mti, _ = m.Mti.Response()
+			m.Set(ResponseCode, "00")
+			// the host assigns an RRN and echoes a terminal ID
+			m.Set(RefNo, "000000000042")
+			m.Set(TERMINAL, "TERM0001")
+			if err := WriteMessage(remote, framer, spec, m, nil); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	late := make(chan *Iso8583Message, 1)
+	c := NewClient(local, spec, framer)
+	c.OnUnmatched = func(m *Iso8583Message) { late <- m }
+	defer c.Close()
+
+	req := sampleMessage()
+	req.Unset(RefNo)
+	resp, err := c.Send(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Get(RefNo) != "000000000042" {
+		t.Errorf("got RRN %q", resp.Get(RefNo))
+	}
+
+	// a response with another RRN does not answer the request
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Send(ctx, sampleMessage()); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	select {
+	case <-late:
+	case <-time.After(time.Second):
+		t.Error("mismatched response was not reported")
+	}
+	if c.Pending() != 0 {
+		t.Errorf("%d requests left pending", c.Pending())
+	}
+}
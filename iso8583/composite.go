@@ -0,0 +1,278 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SubfieldLayout tells how subfields are packed in a composite field
+type SubfieldLayout int
+
+// Supported subfield layouts
+const (
+	FixedSubfields  SubfieldLayout = iota // subfields 1, 2, ... one after another
+	TLVSubfields                          // 2 character tag, length digits, value
+	BitmapSubfields                       // a 64 bit bitmap followed by the present subfields
+)
+
+// ErrBadPath is returned for malformed "48.3" style field paths
+var ErrBadPath = errors.New("iso8583: bad field path")
+
+// CompositeField is a field made of subfields, like the private use
+// fields 48 and 60-63. Outer frames the whole field on the wire.
+//
+// Subfields are numbered from 1 for the fixed and bitmap layouts and
+// addressed by their 2 character tag for the TLV layout.
+type CompositeField struct {
+	Outer     IField
+	Layout    SubfieldLayout
+	Subfields map[int]IField // fixed and bitmap layouts, by subfield number
+	Bitmap    BitmapEncoding // bitmap layout
+	LenDigits int            // TLV layout, digits of the length after each tag, 3 if 0
+}
+
+func (f *CompositeField) Read(r io.Reader) (string, error) {
+	return f.Outer.Read(r)
+}
+
+func (f *CompositeField) Write(w io.Writer, s string) error {
+	return f.Outer.Write(w, s)
+}
+
+// Unpack splits a raw field value into its subfields
+func (f *CompositeField) Unpack(raw string) (map[string]string, error) {
+	sub := make(map[string]string)
+	r := strings.NewReader(raw)
+
+	switch f.Layout {
+	case FixedSubfields:
+		for _, no := range f.numbers() {
+			if r.Len() == 0 {
+				// trailing subfields may be left out
+				break
+			}
+			v, err := f.Subfields[no].Read(r)
+			if err != nil {
+				return nil, subfieldError(no, err)
+			}
+			sub[strconv.Itoa(no)] = v
+		}
+
+	case BitmapSubfields:
+		buf := make([]byte, f.Bitmap.blockSize())
+		bits := make([]bool, 64)
+		if err := readFull(r, buf); err != nil {
+			return nil, subfieldError(0, err)
+		}
+		if err := f.Bitmap.decode(buf, bits); err != nil {
+			return nil, subfieldError(0, err)
+		}
+		for i, set := range bits {
+			if !set {
+				continue
+			}
+			sf, ok := f.Subfields[i+1]
+			if !ok {
+				return nil, subfieldError(i+1, ErrNoField)
+			}
+			v, err := sf.Read(r)
+			if err != nil {
+				return nil, subfieldError(i+1, err)
+			}
+			sub[strconv.Itoa(i+1)] = v
+		}
+
+	case TLVSubfields:
+		for r.Len() > 0 {
+			tag := make([]byte, 2)
+			if err := readFull(r, tag); err != nil {
+				return nil, err
+			}
+			v, err := readVar(r, f.lenDigits(), maxDigits(f.lenDigits()), ASCII, ASCII)
+			if err != nil {
+				return nil, fmt.Errorf("subfield %s: %v", tag, err)
+			}
+			sub[string(tag)] = v
+		}
+	}
+
+	if r.Len() > 0 {
+		return nil, fmt.Errorf("%d bytes left after subfields", r.Len())
+	}
+	return sub, nil
+}
+
+// Pack joins subfield values into a raw field value
+func (f *CompositeField) Pack(sub map[string]string) (string, error) {
+	var buf bytes.Buffer
+
+	switch f.Layout {
+	case FixedSubfields:
+		// write up to the last subfield set
+		last := 0
+		for _, no := range f.numbers() {
+			if _, ok := sub[strconv.Itoa(no)]; ok {
+				last = no
+			}
+		}
+		for _, no := range f.numbers() {
+			if no > last {
+				break
+			}
+			if err := f.Subfields[no].Write(&buf, sub[strconv.Itoa(no)]); err != nil {
+				return "", subfieldError(no, err)
+			}
+		}
+
+	case BitmapSubfields:
+		bits := make([]bool, 64)
+		for _, no := range f.numbers() {
+			_, bits[no-1] = sub[strconv.Itoa(no)]
+		}
+		buf.Write(f.Bitmap.encode(bits))
+		for _, no := range f.numbers() {
+			if !bits[no-1] {
+				continue
+			}
+			if err := f.Subfields[no].Write(&buf, sub[strconv.Itoa(no)]); err != nil {
+				return "", subfieldError(no, err)
+			}
+		}
+
+	case TLVSubfields:
+		tags := make([]string, 0, len(sub))
+		for tag := range sub {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			if len(tag) != 2 {
+				return "", fmt.Errorf("subfield %s: tag must have 2 characters", tag)
+			}
+			buf.WriteString(tag)
+			if err := writeVar(&buf, f.lenDigits(), maxDigits(f.lenDigits()), ASCII, ASCII, sub[tag]); err != nil {
+				return "", fmt.Errorf("subfield %s: %v", tag, err)
+			}
+		}
+	}
+
+	for no := range sub {
+		if !f.has(no) {
+			return "", fmt.Errorf("subfield %s: %v", no, ErrNoField)
+		}
+	}
+	return buf.String(), nil
+}
+
+// has reports whether the subfield id is defined
+func (f *CompositeField) has(id string) bool {
+	if f.Layout == TLVSubfields {
+		return true
+	}
+	no, err := strconv.Atoi(id)
+	if err != nil {
+		return false
+	}
+	_, ok := f.Subfields[no]
+	return ok && (f.Layout != BitmapSubfields || no <= 64)
+}
+
+// numbers returns the defined subfield numbers in order
+func (f *CompositeField) numbers() []int {
+	nos := make([]int, 0, len(f.Subfields))
+	for no := range f.Subfields {
+		if f.Layout == BitmapSubfields && (no < 1 || no > 64) {
+			continue
+		}
+		nos = append(nos, no)
+	}
+	sort.Ints(nos)
+	return nos
+}
+
+func (f *CompositeField) lenDigits() int {
+	if f.LenDigits == 0 {
+		return 3
+	}
+	return f.LenDigits
+}
+
+func maxDigits(digits int) int {
+	max := 1
+	for i := 0; i < digits; i++ {
+		max *= 10
+	}
+	return max - 1
+}
+
+func subfieldError(no int, err error) error {
+	if no == 0 {
+		return fmt.Errorf("subfield bitmap: %v", err)
+	}
+	return fmt.Errorf("subfield %d: %v", no, err)
+}
+
+// splitPath splits "48.3" into 48 and "3"
+func splitPath(path string) (uint, string, error) {
+	field, sub := path, ""
+	if i := strings.IndexByte(path, '.'); i >= 0 {
+		field, sub = path[:i], path[i+1:]
+		if sub == "" {
+			return 0, "", ErrBadPath
+		}
+	}
+	no, err := strconv.ParseUint(field, 10, 0)
+	if err != nil || no > MaxField {
+		return 0, "", ErrBadPath
+	}
+	return uint(no), sub, nil
+}
+
+// GetPath returns a field ("48") or subfield ("48.3", "48.AB") value
+func (m *Iso8583Message) GetPath(path string) string {
+	no, sub, err := splitPath(path)
+	if err != nil {
+		return ""
+	}
+	if sub == "" {
+		return m.Get(no)
+	}
+	return m.sub[no][sub]
+}
+
+// SetPath sets a field ("48") or subfield ("48.3", "48.AB") value.
+// Subfields are packed into their field by Serialize, which fails if
+// the spec does not define the field as a CompositeField. Setting a
+// subfield clears the raw field value, Get returns "" until the message
+// is serialized and parsed again.
+func (m *Iso8583Message) SetPath(path, value string) error {
+	no, sub, err := splitPath(path)
+	if err != nil {
+		return err
+	}
+	if sub == "" {
+		m.Set(no, value)
+		return nil
+	}
+	if no < 2 || no == 65 {
+		return ErrBadPath
+	}
+
+	if m.sub == nil {
+		m.sub = make(map[uint]map[string]string)
+	}
+	if m.sub[no] == nil {
+		m.sub[no] = make(map[string]string)
+	}
+	m.sub[no][sub] = value
+	m.values[no] = ""
+	m.Bitmap[no-1] = true
+	return nil
+}
@@ -0,0 +1,121 @@
+package iso8583
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func compositeSpec() *Spec {
+	spec := DefaultSpec()
+	spec.SetField(48, &CompositeField{
+		Outer:  &LLLField{Type: "ans...", Length: 999},
+		Layout: FixedSubfields,
+		Subfields: map[int]IField{
+			1: &Field{Type: "n", Length: 2},
+			2: &Field{Type: "an", Length: 4},
+			3: &LLField{Type: "ans..", Length: 20},
+		},
+	})
+	spec.SetField(62, &CompositeField{
+		Outer:  &LLLField{Type: "ans...", Length: 999},
+		Layout: TLVSubfields,
+	})
+	spec.SetField(63, &CompositeField{
+		Outer:  &LLLField{Type: "ans...", Length: 999},
+		Layout: BitmapSubfields,
+		Bitmap: BitmapHex,
+		Subfields: map[int]IField{
+			1: &Field{Type: "an", Length: 3},
+			2: &LLField{Type: "ans..", Length: 10},
+			9: &Field{Type: "n", Length: 4},
+		},
+	})
+	return spec
+}
+
+func TestCompositeFields(t *testing.T) {
+	spec := compositeSpec()
+	msg := sampleMessage()
+	msg.Unset(AdditionalData)
+
+	for path, v := range map[string]string{
+		"48.1": "7", "48.2": "AB", "48.3": "hello",
+		"62.01": "abc", "62.XY": "z",
+		"63.2": "two", "63.9": "12",
+	} {
+		if err := msg.SetPath(path, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := msg.Serialize(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, raw := range []string{"01307  AB05hello", "01401003abcXY001z", "025408000000000000003two0012"} {
+		if !bytes.Contains(buf.Bytes(), []byte(raw)) {
+			t.Errorf("%q not found in %q", raw, buf.Bytes())
+		}
+	}
+
+	got := new(Iso8583Message)
+	if err := got.Parse(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"48.1": "7", "48.2": "AB", "48.3": "hello",
+		"62.01": "abc", "62.XY": "z", "63.1": "", "63.2": "two", "63.9": "12",
+		"48": "07  AB05hello", "2": "4111111111111111",
+	}
+	for path, want := range tests {
+		if v := got.GetPath(path); v != want {
+			t.Errorf("%s = %q, want %q", path, v, want)
+		}
+	}
+
+	// a subfield clears the stale raw value
+	got.SetPath("48.2", "CD")
+	if v := got.GetPath("48"); v != "" {
+		t.Errorf("raw value %q kept after SetPath", v)
+	}
+
+	// a raw value replaces the subfields
+	got.Set(48, "01ABCD")
+	if got.GetPath("48.2") != "" {
+		t.Error("subfields survived Set")
+	}
+}
+
+func TestCompositeErrors(t *testing.T) {
+	spec := compositeSpec()
+
+	msg := sampleMessage()
+	msg.Unset(AdditionalData)
+	msg.SetPath("48.4", "x")
+	if err := msg.Serialize(spec, new(bytes.Buffer)); err == nil {
+		t.Error("undefined subfield was accepted")
+	}
+
+	msg.Set(48, "07  AB05hello!")
+	var buf bytes.Buffer
+	if err := msg.Serialize(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := new(Iso8583Message).Parse(spec, &buf); err == nil {
+		t.Error("trailing subfield data was accepted")
+	}
+
+	// subfields of a field the spec does not split
+	plain := sampleMessage()
+	plain.SetPath("44.1", "x")
+	if err := plain.Serialize(spec, new(bytes.Buffer)); !errors.Is(err, ErrNotComposite) {
+		t.Errorf("got %v, want %v", err, ErrNotComposite)
+	}
+
+	for _, path := range []string{"", "x", "48.", "1.2", "200"} {
+		if err := msg.SetPath(path, "v"); err != ErrBadPath {
+			t.Errorf("%q: got %v, want %v", path, err, ErrBadPath)
+		}
+	}
+}
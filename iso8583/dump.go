@@ -0,0 +1,191 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ubs121/encoding/iso8583/emv"
+)
+
+// DefaultMasks hides card data in dumps: the PAN (fields 2 and 34) shows
+// only its first 6 and last 4 digits, track data (35, 36, 45) and the PIN
+// block (52) are hidden and the ICC data (55) is shown without its card
+// data. Dumpers using DefaultMasks also hide every field the spec names
+// as a card verification value, like a CVV2 in a private field.
+var DefaultMasks = map[uint]func(string) string{
+	CardNo: MaskPAN,
+	34:     MaskPAN,
+	DATA2:  MaskTrack,
+	36:     MaskAll,
+	45:     MaskTrack,
+	52:     MaskAll,
+	55:     MaskICC,
+}
+
+// iccCardData are the EMV tags hidden by MaskICC: track 1 and 2
+// equivalent data, the PAN, the cardholder name and the track 2 data of
+// contactless mag stripe mode
+var iccCardData = map[emv.Tag]bool{
+	0x56: true, 0x57: true, 0x5A: true, 0x5F20: true, 0x9F6B: true,
+}
+
+// MaskPAN keeps the first 6 and last 4 digits of a card number
+func MaskPAN(pan string) string {
+	if len(pan) <= 10 {
+		return strings.Repeat("*", len(pan))
+	}
+	return pan[:6] + strings.Repeat("*", len(pan)-10) + pan[len(pan)-4:]
+}
+
+// MaskTrack masks the PAN of track 1 or 2 data and hides everything
+// after it
+func MaskTrack(track string) string {
+	start := 0
+	if track != "" && isAlpha(rune(track[0])) && track[0] != 'D' {
+		// track 1 format code
+		start = 1
+	}
+	sep := strings.IndexAny(track[start:], "=D^")
+	if sep < 0 {
+		return MaskAll(track)
+	}
+	sep += start
+	return track[:start] + MaskPAN(track[start:sep]) + track[sep:sep+1] + MaskAll(track[sep+1:])
+}
+
+// MaskAll hides the whole value
+func MaskAll(s string) string {
+	return strings.Repeat("*", len(s))
+}
+
+// MaskICC formats binary ICC data (field 55) in hex with the values of
+// the card data tags hidden. Data that is not valid BER-TLV is hidden
+// completely.
+func MaskICC(data string) string {
+	list, err := emv.Decode([]byte(data))
+	if err != nil {
+		return MaskAll(fmt.Sprintf("%X", data))
+	}
+	var sb strings.Builder
+	maskTLV(&sb, list)
+	return sb.String()
+}
+
+func maskTLV(sb *strings.Builder, list []emv.TLV) {
+	for _, v := range list {
+		value := v.Value
+		if v.Tag.Constructed() {
+			value = emv.Encode(v.Children)
+		}
+		raw := fmt.Sprintf("%X", emv.Encode([]emv.TLV{v}))
+		sb.WriteString(raw[:len(raw)-2*len(value)])
+		switch {
+		case v.Tag.Constructed():
+			maskTLV(sb, v.Children)
+		case iccCardData[v.Tag]:
+			sb.WriteString(strings.Repeat("*", 2*len(value)))
+		default:
+			fmt.Fprintf(sb, "%X", value)
+		}
+	}
+}
+
+// isCVV tells whether a field name is that of a card verification value
+func isCVV(name string) bool {
+	name = strings.ToUpper(name)
+	return strings.Contains(name, "CVV") || strings.Contains(name, "CVC") ||
+		strings.Contains(name, "CARD VERIFICATION")
+}
+
+// Dumper prints messages for logs and debugging, one line per field
+// with its number, name and value. Binary fields are shown in hex.
+type Dumper struct {
+	Spec *Spec
+	// Masks maps field numbers to masking functions, nil means
+	// DefaultMasks
+	Masks map[uint]func(string) string
+	// Unmasked prints all values as they are
+	Unmasked bool
+}
+
+// Dump returns the dump of m with the default masks
+func Dump(spec *Spec, m *Iso8583Message) string {
+	var sb strings.Builder
+	(&Dumper{Spec: spec}).Dump(&sb, m)
+	return sb.String()
+}
+
+func (d *Dumper) mask(spec *Spec, no uint, value string) (string, bool) {
+	if d.Unmasked {
+		return value, false
+	}
+	masks := d.Masks
+	if masks == nil {
+		masks = DefaultMasks
+	}
+	if f := masks[no]; f != nil {
+		return f(value), true
+	}
+	if d.Masks == nil && isCVV(spec.FieldName(no)) {
+		return MaskAll(value), true
+	}
+	return value, false
+}
+
+// Dump writes m to w
+func (d *Dumper) Dump(w io.Writer, m *Iso8583Message) error {
+	bw := bufio.NewWriter(w)
+	spec := d.Spec
+	if spec == nil {
+		spec = std
+	}
+
+	fmt.Fprintf(bw, "MTI  %s\n", m.Mti)
+
+	// bitmap with its indicator bits, without touching m
+	tmp := Iso8583Message{Bitmap: m.Bitmap}
+	blocks := tmp.bitmapBlocks()
+	hex := make([]string, blocks)
+	for i := range hex {
+		hex[i] = string(BitmapHex.encode(tmp.Bitmap[i*64 : (i+1)*64]))
+	}
+	fmt.Fprintf(bw, "BMP  %s\n", strings.Join(hex, " "))
+
+	var present []string
+	for no := uint(2); no <= MaxField; no++ {
+		if m.Bitmap[no-1] && no != 65 {
+			present = append(present, fmt.Sprint(no))
+		}
+	}
+	fmt.Fprintf(bw, "     fields %s\n", strings.Join(present, " "))
+
+	for no := uint(2); no <= MaxField; no++ {
+		if !m.Bitmap[no-1] || no == 65 {
+			continue
+		}
+		value, masked := d.mask(spec, no, m.Get(no))
+		typ, _, _, _ := fieldInfo(spec.Field(no))
+		if typ == "b" && !masked {
+			value = fmt.Sprintf("%X", value)
+		}
+		fmt.Fprintf(bw, "%3d  %-40s %d [%s]\n", no, spec.FieldName(no), len(m.Get(no)), value)
+
+		if masked || len(m.sub[no]) == 0 {
+			continue
+		}
+		ids := make([]string, 0, len(m.sub[no]))
+		for id := range m.sub[no] {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			fmt.Fprintf(bw, "     %-40s [%s]\n", fmt.Sprintf("%d.%s", no, id), m.sub[no][id])
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,69 @@
+package iso8583
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		fn   func(string) string
+		in   string
+		want string
+	}{
+		{MaskPAN, "4111111111111111", "411111******1111"},
+		{MaskPAN, "123456", "******"},
+		{MaskTrack, "4111111111111111=25121010000012300000", "411111******1111=********************"},
+		{MaskTrack, "4111111111111111D2512101", "411111******1111D*******"},
+		{MaskTrack, "B4111111111111111^DOE/JOHN^2512101", "B411111******1111^****************"},
+		{MaskTrack, "garbage", "*******"},
+		{MaskAll, "1234", "****"},
+		{MaskICC, "\x9f\x27\x01\x80\x5a\x02\x41\x11", "9F2701805A02****"},
+		{MaskICC, "\x70\x04\x57\x02\x41\x11", "70045702****"},
+		{MaskICC, "\x9f\x27\x05\x80", "********"},
+	}
+	for _, tt := range tests {
+		if got := tt.fn(tt.in); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	spec := DefaultSpec()
+	spec.Names[AdditionalData] = "CVV2 Data"
+	msg := sampleMessage()
+	msg.Set(DATA2, "4111111111111111=2512101")
+	msg.Set(PinData, "\x01\x23\x45\x67\x89\xAB\xCD\xEF")
+	msg.Set(55, "\x9f\x27\x01\x80\x5a\x08\x41\x11\x11\x11\x11\x11\x11\x11")
+
+	out := Dump(spec, msg)
+	for _, want := range []string{
+		"MTI  0200 1987 Financial Request from Acquirer\n",
+		"BMP  F02000002A011200 0000000004000000\n",
+		"     fields 2 3 4 11 35 37 39 48 52 55 102\n",
+		"  2  Primary Account Number",
+		"[411111******1111]",
+		"[411111******1111=*******]",
+		"[********]",
+		"[9F2701805A08****************]",
+		" 48  CVV2 Data                                17 [*****************]",
+		"[5001234567]",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dump has no %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "4111111111111111") || strings.Contains(out, "0123456789ABCDEF") || strings.Contains(out, "abcdef") {
+		t.Errorf("card data in dump:\n%s", out)
+	}
+	if msg.Bitmap[0] {
+		t.Error("dump changed the bitmap of the message")
+	}
+
+	var sb strings.Builder
+	(&Dumper{Spec: spec, Unmasked: true}).Dump(&sb, msg)
+	if !strings.Contains(sb.String(), "[4111111111111111]") {
+		t.Errorf("unmasked dump:\n%s", sb.String())
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 ubs121
+
+package emv
+
+// TagInfo describes a tag of the dictionary. Format is one of the EMV
+// data formats: a, an, ans, b, cn or n.
+type TagInfo struct {
+	Name   string
+	Format string
+}
+
+// Tags is the dictionary of common EMV tags
+var Tags = map[Tag]TagInfo{
+	0x4F:   {"Application Identifier (AID)", "b"},
+	0x50:   {"Application Label", "ans"},
+	0x57:   {"Track 2 Equivalent Data", "b"},
+	0x5A:   {"Application PAN", "cn"},
+	0x5F20: {"Cardholder Name", "ans"},
+	0x5F24: {"Application Expiration Date", "n"},
+	0x5F25: {"Application Effective Date", "n"},
+	0x5F28: {"Issuer Country Code", "n"},
+	0x5F2A: {"Transaction Currency Code", "n"},
+	0x5F2D: {"Language Preference", "an"},
+	0x5F30: {"Service Code", "n"},
+	0x5F34: {"Application PAN Sequence Number", "n"},
+	0x70:   {"READ RECORD Response Message Template", "b"},
+	0x71:   {"Issuer Script Template 1", "b"},
+	0x72:   {"Issuer Script Template 2", "b"},
+	0x77:   {"Response Message Template Format 2", "b"},
+	0x80:   {"Response Message Template Format 1", "b"},
+	0x82:   {"Application Interchange Profile", "b"},
+	0x84:   {"Dedicated File (DF) Name", "b"},
+	0x86:   {"Issuer Script Command", "b"},
+	0x8A:   {"Authorisation Response Code", "an"},
+	0x8E:   {"Cardholder Verification Method (CVM) List", "b"},
+	0x91:   {"Issuer Authentication Data", "b"},
+	0x95:   {"Terminal Verification Results", "b"},
+	0x9A:   {"Transaction Date", "n"},
+	0x9B:   {"Transaction Status Information", "b"},
+	0x9C:   {"Transaction Type", "n"},
+	0x9F02: {"Amount, Authorised (Numeric)", "n"},
+	0x9F03: {"Amount, Other (Numeric)", "n"},
+	0x9F06: {"Application Identifier (AID) - terminal", "b"},
+	0x9F07: {"Application Usage Control", "b"},
+	0x9F08: {"Application Version Number", "b"},
+	0x9F09: {"Application Version Number (terminal)", "b"},
+	0x9F0D: {"Issuer Action Code - Default", "b"},
+	0x9F0E: {"Issuer Action Code - Denial", "b"},
+	0x9F0F: {"Issuer Action Code - Online", "b"},
+	0x9F10: {"Issuer Application Data", "b"},
+	0x9F12: {"Application Preferred Name", "ans"},
+	0x9F18: {"Issuer Script Identifier", "b"},
+	0x9F1A: {"Terminal Country Code", "n"},
+	0x9F1E: {"Interface Device (IFD) Serial Number", "an"},
+	0x9F21: {"Transaction Time", "n"},
+	0x9F26: {"Application Cryptogram", "b"},
+	0x9F27: {"Cryptogram Information Data", "b"},
+	0x9F33: {"Terminal Capabilities", "b"},
+	0x9F34: {"Cardholder Verification Method (CVM) Results", "b"},
+	0x9F35: {"Terminal Type", "n"},
+	0x9F36: {"Application Transaction Counter (ATC)", "b"},
+	0x9F37: {"Unpredictable Number", "b"},
+	0x9F40: {"Additional Terminal Capabilities", "b"},
+	0x9F41: {"Transaction Sequence Counter", "n"},
+	0x9F53: {"Transaction Category Code", "an"},
+	0x9F5B: {"Issuer Script Results", "b"},
+	0x9F6E: {"Form Factor Indicator", "b"},
+}
@@ -0,0 +1,206 @@
+// Copyright 2015 ubs121
+
+// Package emv decodes and encodes EMV BER-TLV data, such as the ICC
+// data carried in ISO 8583 field 55
+package emv
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Reasons TLV data can fail to decode
+var (
+	ErrTruncated = errors.New("emv: truncated TLV data")
+	ErrBadLength = errors.New("emv: bad TLV length")
+	ErrBadTag    = errors.New("emv: bad tag")
+)
+
+// Tag is a BER-TLV tag, the tag bytes read as a big endian number
+type Tag uint32
+
+// ParseTag converts the hex form of a tag, like "9F26"
+func ParseTag(s string) (Tag, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) == 0 || len(b) > 4 {
+		return 0, ErrBadTag
+	}
+	var t Tag
+	for _, c := range b {
+		t = t<<8 | Tag(c)
+	}
+	return t, nil
+}
+
+// String returns the tag in hex
+func (t Tag) String() string {
+	return strings.ToUpper(hex.EncodeToString(t.bytes()))
+}
+
+// Constructed reports whether the tag holds nested TLVs
+func (t Tag) Constructed() bool {
+	return t.bytes()[0]&0x20 != 0
+}
+
+// Name returns the name of the tag from the dictionary
+func (t Tag) Name() string {
+	return Tags[t].Name
+}
+
+func (t Tag) bytes() []byte {
+	b := []byte{byte(t >> 24), byte(t >> 16), byte(t >> 8), byte(t)}
+	for len(b) > 1 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+// TLV is a single data object. Constructed objects keep their nested
+// objects in Children and have no Value.
+type TLV struct {
+	Tag      Tag
+	Value    []byte
+	Children []TLV
+}
+
+// String formats the object as "TAG: VALUE" in hex
+func (v TLV) String() string {
+	if v.Tag.Constructed() {
+		parts := make([]string, len(v.Children))
+		for i, c := range v.Children {
+			parts[i] = c.String()
+		}
+		return fmt.Sprintf("%s: [%s]", v.Tag, strings.Join(parts, ", "))
+	}
+	return fmt.Sprintf("%s: %X", v.Tag, v.Value)
+}
+
+// Decode parses a list of data objects. Padding bytes (00 and FF)
+// between objects are skipped.
+func Decode(data []byte) ([]TLV, error) {
+	var list []TLV
+	for len(data) > 0 {
+		if data[0] == 0x00 || data[0] == 0xFF {
+			data = data[1:]
+			continue
+		}
+
+		tag, rest, err := readTag(data)
+		if err != nil {
+			return nil, err
+		}
+		n, rest, err := readLength(rest)
+		if err != nil {
+			return nil, err
+		}
+		if n > len(rest) {
+			return nil, ErrTruncated
+		}
+
+		v := TLV{Tag: tag}
+		if tag.Constructed() {
+			if v.Children, err = Decode(rest[:n]); err != nil {
+				return nil, err
+			}
+		} else {
+			v.Value = rest[:n:n]
+		}
+		list = append(list, v)
+		data = rest[n:]
+	}
+	return list, nil
+}
+
+// Encode serializes a list of data objects
+func Encode(list []TLV) []byte {
+	var buf []byte
+	for _, v := range list {
+		value := v.Value
+		if v.Tag.Constructed() {
+			value = Encode(v.Children)
+		}
+		buf = append(buf, v.Tag.bytes()...)
+		buf = appendLength(buf, len(value))
+		buf = append(buf, value...)
+	}
+	return buf
+}
+
+// Find returns the first object with the given tag, searching nested
+// objects as well
+func Find(list []TLV, tag Tag) *TLV {
+	for i := range list {
+		if list[i].Tag == tag {
+			return &list[i]
+		}
+		if v := Find(list[i].Children, tag); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// readTag reads a one or more byte tag. Low 5 bits all set in the first
+// byte announce more bytes, which follow while their high bit is set.
+func readTag(data []byte) (Tag, []byte, error) {
+	t := Tag(data[0])
+	i := 1
+	if data[0]&0x1F == 0x1F {
+		for {
+			if i >= len(data) {
+				return 0, nil, ErrTruncated
+			}
+			if i == 4 {
+				return 0, nil, ErrBadTag
+			}
+			t = t<<8 | Tag(data[i])
+			i++
+			if data[i-1]&0x80 == 0 {
+				break
+			}
+		}
+	}
+	return t, data[i:], nil
+}
+
+// readLength reads a short (one byte) or long (81-84 followed by the
+// length bytes) form length
+func readLength(data []byte) (int, []byte, error) {
+	if len(data) == 0 {
+		return 0, nil, ErrTruncated
+	}
+	if data[0] < 0x80 {
+		return int(data[0]), data[1:], nil
+	}
+
+	k := int(data[0] & 0x7F)
+	if k == 0 || k > 4 {
+		return 0, nil, ErrBadLength
+	}
+	if len(data) < 1+k {
+		return 0, nil, ErrTruncated
+	}
+	// 4 length bytes may not fit an int, check against the data left
+	var n uint64
+	for _, c := range data[1 : 1+k] {
+		n = n<<8 | uint64(c)
+	}
+	if n > uint64(len(data)-1-k) {
+		return 0, nil, ErrTruncated
+	}
+	return int(n), data[1+k:], nil
+}
+
+func appendLength(buf []byte, n int) []byte {
+	switch {
+	case n < 0x80:
+		return append(buf, byte(n))
+	case n <= 0xFF:
+		return append(buf, 0x81, byte(n))
+	case n <= 0xFFFF:
+		return append(buf, 0x82, byte(n>>8), byte(n))
+	}
+	return append(buf, 0x83, byte(n>>16), byte(n>>8), byte(n))
+}
@@ -0,0 +1,113 @@
+package emv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+const field55 = "9F26081122334455667788" + "9F270180" + "95050000008000" +
+	"9A03231017" + "9C0100" + "9F0206000000001500" + "5F2A020496" + "9F1A020496" +
+	"7110" + "9F180400000001" + "8607842400000802AB"
+
+func TestDecode(t *testing.T) {
+	data, _ := hex.DecodeString(field55)
+	list, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 9 {
+		t.Fatalf("got %d objects: %v", len(list), list)
+	}
+
+	tests := []struct {
+		tag   string
+		value string
+	}{
+		{"9F26", "1122334455667788"},
+		{"9F27", "80"},
+		{"95", "0000008000"},
+		{"9A", "231017"},
+		{"5F2A", "0496"},
+		{"9F18", "00000001"},
+		{"86", "842400000802AB"},
+	}
+	for _, tt := range tests {
+		tag, _ := ParseTag(tt.tag)
+		v := Find(list, tag)
+		if v == nil || strings.ToUpper(hex.EncodeToString(v.Value)) != tt.value {
+			t.Errorf("%s: got %v", tt.tag, v)
+		}
+	}
+
+	script := Find(list, 0x71)
+	if script == nil || len(script.Children) != 2 || script.Value != nil {
+		t.Errorf("constructed tag 71 = %v", script)
+	}
+	if Tag(0x9F26).Name() != "Application Cryptogram" || Tags[0x9A].Format != "n" {
+		t.Error("dictionary lookup failed")
+	}
+	if Tag(0x9F26).String() != "9F26" || Tag(0x5F2A).Constructed() || !Tag(0x71).Constructed() {
+		t.Error("tag helpers failed")
+	}
+
+	if got := Encode(list); !bytes.Equal(got, data) {
+		t.Errorf("re-encoded %X, want %X", got, data)
+	}
+}
+
+func TestLongForms(t *testing.T) {
+	value := bytes.Repeat([]byte{0xAB}, 300)
+	list := []TLV{
+		{Tag: 0x9F10, Value: value[:200]},
+		{Tag: 0xDF8101, Value: value},
+	}
+	data := Encode(list)
+	if !bytes.HasPrefix(data, []byte{0x9F, 0x10, 0x81, 0xC8}) {
+		t.Errorf("got header %X", data[:4])
+	}
+	if !bytes.HasPrefix(data[204:], []byte{0xDF, 0x81, 0x01, 0x82, 0x01, 0x2C}) {
+		t.Errorf("got header %X", data[204:210])
+	}
+
+	got, err := Decode(append([]byte{0x00, 0x00}, data...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1].Tag != 0xDF8101 || !bytes.Equal(got[1].Value, value) {
+		t.Errorf("got %v", got)
+	}
+
+	// the longest form, 84 and 4 length bytes
+	got, err = Decode([]byte{0x9F, 0x26, 0x84, 0x00, 0x00, 0x00, 0x01, 0x0A})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !bytes.Equal(got[0].Value, []byte{0x0A}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		err  error
+	}{
+		{"9F", ErrTruncated},
+		{"9F26", ErrTruncated},
+		{"9F2608112233", ErrTruncated},
+		{"9F2685000000000001", ErrBadLength},
+		{"9F2681", ErrTruncated},
+		{"9F2684000001", ErrTruncated},
+		{"9F2684FFFFFFFF00", ErrTruncated},
+		{"DF8181818101", ErrBadTag},
+		{"7103950200", ErrTruncated},
+	}
+	for _, tt := range tests {
+		data, _ := hex.DecodeString(tt.data)
+		if _, err := Decode(data); err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.data, err, tt.err)
+		}
+	}
+}
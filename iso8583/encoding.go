@@ -0,0 +1,162 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import "strconv"
+
+// Encoder converts field values to and from their wire form
+type Encoder interface {
+	// Encode returns the wire form of s
+	Encode(s string) ([]byte, error)
+	// Decode converts the wire form of n characters back to a string
+	Decode(b []byte, n int) (string, error)
+	// Size returns the wire size of n characters
+	Size(n int) int
+}
+
+// Value and length encoders
+var (
+	ASCII     Encoder = asciiEncoder{}
+	Binary    Encoder = binaryEncoder{}
+	BCD       Encoder = bcdEncoder{left: true} // odd lengths padded with 0 on the left
+	RightBCD  Encoder = bcdEncoder{}           // odd lengths padded with 0 on the right
+	RightBCDF Encoder = bcdEncoder{pad: 0x0F}  // odd lengths padded with F on the right
+	EBCDIC    Encoder = CP037
+)
+
+type asciiEncoder struct{}
+
+func (asciiEncoder) Encode(s string) ([]byte, error) {
+	return []byte(s), nil
+}
+
+func (asciiEncoder) Decode(b []byte, n int) (string, error) {
+	return string(b), nil
+}
+
+func (asciiEncoder) Size(n int) int {
+	return n
+}
+
+// binaryEncoder keeps raw bytes, as a length indicator it is a big
+// endian number
+type binaryEncoder struct {
+	asciiEncoder
+}
+
+// bcdEncoder packs two digits per byte. 'D' (or '=') is packed as 0xD so
+// track 2 data can be carried as well.
+type bcdEncoder struct {
+	left bool
+	pad  byte
+}
+
+func (e bcdEncoder) Encode(s string) ([]byte, error) {
+	buf := make([]byte, e.Size(len(s)))
+	odd := len(s)%2 == 1
+
+	shift := 0
+	if odd && e.left {
+		shift = 1
+	} else if odd {
+		buf[len(buf)-1] = e.pad
+	}
+
+	for i := 0; i < len(s); i++ {
+		var v byte
+		switch c := s[i]; {
+		case '0' <= c && c <= '9':
+			v = c - '0'
+		case c == 'D' || c == '=':
+			v = 0x0D
+		default:
+			return nil, ErrBadBCD
+		}
+		j := i + shift
+		if j%2 == 0 {
+			buf[j/2] |= v << 4
+		} else {
+			buf[j/2] = buf[j/2]&0xF0 | v
+		}
+	}
+	return buf, nil
+}
+
+func (e bcdEncoder) Decode(b []byte, n int) (string, error) {
+	shift := 0
+	if n%2 == 1 && e.left {
+		shift = 1
+	}
+
+	buf := make([]byte, n)
+	for i := range buf {
+		j := i + shift
+		v := b[j/2] & 0x0F
+		if j%2 == 0 {
+			v = b[j/2] >> 4
+		}
+		switch {
+		case v <= 9:
+			buf[i] = '0' + v
+		case v == 0x0D:
+			buf[i] = 'D'
+		default:
+			return "", ErrBadBCD
+		}
+	}
+	return string(buf), nil
+}
+
+func (bcdEncoder) Size(n int) int {
+	return (n + 1) / 2
+}
+
+// lengthSize returns the wire size of a length indicator of 'digits' digits
+func lengthSize(enc Encoder, digits int) int {
+	if _, ok := enc.(binaryEncoder); ok {
+		return (digits + 1) / 2
+	}
+	return enc.Size(digits)
+}
+
+// encodeLength formats the length indicator n
+func encodeLength(enc Encoder, n, digits int) ([]byte, error) {
+	if _, ok := enc.(binaryEncoder); ok {
+		buf := make([]byte, lengthSize(enc, digits))
+		for i := len(buf) - 1; i >= 0; i-- {
+			buf[i] = byte(n)
+			n >>= 8
+		}
+		return buf, nil
+	}
+
+	s := strconv.Itoa(n)
+	for len(s) < digits {
+		s = "0" + s
+	}
+	return enc.Encode(s)
+}
+
+// decodeLength parses a length indicator
+func decodeLength(enc Encoder, b []byte, digits int) (int, error) {
+	if _, ok := enc.(binaryEncoder); ok {
+		n := 0
+		for _, c := range b {
+			n = n<<8 | int(c)
+		}
+		return n, nil
+	}
+
+	s, err := enc.Decode(b, digits)
+	if err != nil {
+		return 0, ErrBadLength
+	}
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, ErrBadLength
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	return n, nil
+}
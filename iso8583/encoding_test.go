@@ -0,0 +1,80 @@
+package iso8583
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncoders(t *testing.T) {
+	tests := []struct {
+		enc  Encoder
+		in   string
+		wire []byte
+	}{
+		{ASCII, "123", []byte("123")},
+		{BCD, "1234", []byte{0x12, 0x34}},
+		{BCD, "123", []byte{0x01, 0x23}},
+		{RightBCD, "123", []byte{0x12, 0x30}},
+		{RightBCDF, "123", []byte{0x12, 0x3F}},
+		{RightBCDF, "4111D2512", []byte{0x41, 0x11, 0xD2, 0x51, 0x2F}},
+		{EBCDIC, "12 3", []byte{0xF1, 0xF2, 0x40, 0xF3}},
+	}
+
+	for _, tt := range tests {
+		wire, err := tt.enc.Encode(tt.in)
+		if err != nil || !bytes.Equal(wire, tt.wire) {
+			t.Errorf("%T %q: got %X %v, want %X", tt.enc, tt.in, wire, err, tt.wire)
+			continue
+		}
+		if tt.enc.Size(len(tt.in)) != len(wire) {
+			t.Errorf("%T %q: size %d, want %d", tt.enc, tt.in, tt.enc.Size(len(tt.in)), len(wire))
+		}
+		s, err := tt.enc.Decode(wire, len(tt.in))
+		if err != nil || s != tt.in {
+			t.Errorf("%T %X: got %q %v, want %q", tt.enc, wire, s, err, tt.in)
+		}
+	}
+
+	if _, err := BCD.Encode("12a"); err != ErrBadBCD {
+		t.Errorf("got %v, want %v", err, ErrBadBCD)
+	}
+	if _, err := BCD.Decode([]byte{0x1A}, 2); err != ErrBadBCD {
+		t.Errorf("got %v, want %v", err, ErrBadBCD)
+	}
+}
+
+func TestLengthEncoders(t *testing.T) {
+	tests := []struct {
+		f    IField
+		in   string
+		wire []byte
+	}{
+		{&LLField{Type: "n..", Length: 19, Enc: BCD, LenEnc: BCD}, "12345", []byte{0x05, 0x01, 0x23, 0x45}},
+		{&LLField{Type: "n..", Length: 19, Enc: RightBCD, LenEnc: Binary}, "123", []byte{0x03, 0x12, 0x30}},
+		{&LLLField{Type: "ans...", Length: 999, LenEnc: Binary}, "abc", []byte{0x00, 0x03, 'a', 'b', 'c'}},
+		{&LLLField{Type: "ans...", Length: 999, LenEnc: BCD}, "abc", []byte{0x00, 0x03, 'a', 'b', 'c'}},
+		{&LLField{Type: "ans..", Length: 99, LenEnc: EBCDIC}, "ab", []byte{0xF0, 0xF2, 'a', 'b'}},
+		{&LLField{Type: "ans..", Length: 99}, "ab", []byte("02ab")},
+		{&Field{Type: "n", Length: 6, Enc: BCD}, "123", []byte{0x00, 0x01, 0x23}},
+		{&Field{Type: "b", Length: 4, Enc: Binary}, "\x00\x01\x02\x03", []byte{0, 1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := tt.f.Write(&buf, tt.in); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), tt.wire) {
+			t.Errorf("%q: wrote %X, want %X", tt.in, buf.Bytes(), tt.wire)
+		}
+		s, err := tt.f.Read(&buf)
+		if err != nil || s != tt.in {
+			t.Errorf("%X: read %q %v, want %q", tt.wire, s, err, tt.in)
+		}
+	}
+
+	f := &LLField{Type: "n..", Length: 19, LenEnc: BCD}
+	if _, err := f.Read(bytes.NewReader([]byte{0x1F, 0x31})); err != ErrBadLength {
+		t.Errorf("got %v, want %v", err, ErrBadLength)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Reasons a message can fail to parse or serialize
+var (
+	ErrShortRead     = errors.New("short read")
+	ErrBadLength     = errors.New("bad length digits")
+	ErrLengthTooLong = errors.New("length above max")
+	ErrNoField       = errors.New("field not defined in spec")
+	ErrBadBitmap     = errors.New("bad bitmap digits")
+	ErrBadBCD        = errors.New("bad BCD digit")
+	ErrBadEBCDIC     = errors.New("character not representable in EBCDIC")
+	ErrBadChar       = errors.New("value does not match field type")
+	ErrNotComposite  = errors.New("subfields set on a field that is not composite")
+)
+
+// FieldError describes a failure to read or write a single field.
+// Field 0 is the MTI and field 1 is the bitmap.
+type FieldError struct {
+	Field  uint
+	Offset int64 // byte offset of the field in the message
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("iso8583: field %d at offset %d: %v", e.Field, e.Offset, e.Err)
+}
+
+// Unwrap returns the underlying reason
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,203 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Framing errors
+var (
+	ErrFrameTooLarge = errors.New("iso8583: frame too large")
+	ErrBadFrame      = errors.New("iso8583: bad frame length")
+	// ErrTrailingData is returned by ReadMessage for a frame with bytes
+	// after the message. Only that message is lost, the stream is still
+	// in sync.
+	ErrTrailingData = errors.New("iso8583: bytes left after message")
+)
+
+// DefaultMaxFrame is the largest frame accepted when a framer has no MaxSize
+const DefaultMaxFrame = 8192
+
+// Frame is one message as carried on the wire
+type Frame struct {
+	Header []byte // header bytes following the length, like a TPDU
+	Data   []byte // the ISO 8583 message
+}
+
+// Framer reads and writes complete framed messages
+type Framer interface {
+	ReadFrame(r io.Reader) (*Frame, error)
+	WriteFrame(w io.Writer, f *Frame) error
+}
+
+// LengthFramer frames messages with a length prefix counting the header
+// and message bytes that follow it
+type LengthFramer struct {
+	LenSize    int  // size of the length prefix
+	ASCII      bool // length prefix in ASCII digits instead of big endian binary
+	HeaderSize int  // fixed size header after the length
+	MaxSize    int  // largest frame accepted, DefaultMaxFrame if 0
+}
+
+// NewBinaryFramer frames messages with a 2 byte binary length
+func NewBinaryFramer() *LengthFramer {
+	return &LengthFramer{LenSize: 2}
+}
+
+// NewASCIIFramer frames messages with a 4 digit ASCII length
+func NewASCIIFramer() *LengthFramer {
+	return &LengthFramer{LenSize: 4, ASCII: true}
+}
+
+// NewTPDUFramer frames messages with a 2 byte binary length followed by
+// a 5 byte TPDU
+func NewTPDUFramer() *LengthFramer {
+	return &LengthFramer{LenSize: 2, HeaderSize: 5}
+}
+
+// maxSize returns the largest frame accepted, no more than the length
+// prefix can carry
+func (l *LengthFramer) maxSize() int {
+	max := l.MaxSize
+	if max == 0 {
+		max = DefaultMaxFrame
+	}
+	limit := 1
+	for i := 0; i < l.LenSize && limit <= max; i++ {
+		if l.ASCII {
+			limit *= 10
+		} else {
+			limit <<= 8
+		}
+	}
+	if limit-1 < max {
+		return limit - 1
+	}
+	return max
+}
+
+// ReadFrame reads one frame. A stream that ends cleanly between frames
+// returns io.EOF.
+func (l *LengthFramer) ReadFrame(r io.Reader) (*Frame, error) {
+	lenbuf := make([]byte, l.LenSize)
+	if _, err := io.ReadFull(r, lenbuf); err != nil {
+		return nil, err
+	}
+
+	n := 0
+	for _, c := range lenbuf {
+		if !l.ASCII {
+			n = n<<8 | int(c)
+			continue
+		}
+		if c < '0' || c > '9' {
+			return nil, ErrBadFrame
+		}
+		n = n*10 + int(c-'0')
+	}
+	if n > l.maxSize() {
+		return nil, fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, n)
+	}
+	if n < l.HeaderSize {
+		return nil, ErrBadFrame
+	}
+
+	buf := make([]byte, n)
+	if err := readFull(r, buf); err != nil {
+		return nil, err
+	}
+	return &Frame{Header: buf[:l.HeaderSize:l.HeaderSize], Data: buf[l.HeaderSize:]}, nil
+}
+
+// WriteFrame writes one frame with a single Write call
+func (l *LengthFramer) WriteFrame(w io.Writer, f *Frame) error {
+	if len(f.Header) != l.HeaderSize {
+		return fmt.Errorf("iso8583: frame header has %d bytes, want %d", len(f.Header), l.HeaderSize)
+	}
+	n := len(f.Header) + len(f.Data)
+	if n > l.maxSize() {
+		return fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, n)
+	}
+
+	buf := make([]byte, l.LenSize, l.LenSize+n)
+	for i, v := l.LenSize-1, n; i >= 0; i-- {
+		if l.ASCII {
+			buf[i] = byte('0' + v%10)
+			v /= 10
+		} else {
+			buf[i] = byte(v)
+			v >>= 8
+		}
+	}
+	buf = append(buf, f.Header...)
+	buf = append(buf, f.Data...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// TPDU is the transport protocol data unit header used by many POS
+// networks: an ID byte (usually 0x60) and two 2 byte addresses
+type TPDU struct {
+	ID          byte
+	Destination uint16
+	Source      uint16
+}
+
+// ParseTPDU decodes a 5 byte TPDU header
+func ParseTPDU(b []byte) (TPDU, error) {
+	if len(b) != 5 {
+		return TPDU{}, ErrBadFrame
+	}
+	return TPDU{
+		ID:          b[0],
+		Destination: uint16(b[1])<<8 | uint16(b[2]),
+		Source:      uint16(b[3])<<8 | uint16(b[4]),
+	}, nil
+}
+
+// Bytes encodes the TPDU header
+func (t TPDU) Bytes() []byte {
+	return []byte{t.ID, byte(t.Destination >> 8), byte(t.Destination), byte(t.Source >> 8), byte(t.Source)}
+}
+
+// Reply returns the TPDU of a response, with the addresses swapped
+func (t TPDU) Reply() TPDU {
+	return TPDU{ID: t.ID, Destination: t.Source, Source: t.Destination}
+}
+
+// ReadMessage reads one framed message and parses it with spec
+func ReadMessage(r io.Reader, framer Framer, spec *Spec) (*Iso8583Message, *Frame, error) {
+	f, err := framer.ReadFrame(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := new(Iso8583Message)
+	rd := bytes.NewReader(f.Data)
+	if err := m.Parse(spec, rd); err != nil {
+		return nil, f, err
+	}
+	if rd.Len() > 0 {
+		return nil, f, fmt.Errorf("%w: %d bytes", ErrTrailingData, rd.Len())
+	}
+	return m, f, nil
+}
+
+// isMessageError tells whether err from ReadMessage concerns a single
+// message, the next frame can still be read
+func isMessageError(err error) bool {
+	var fe *FieldError
+	return errors.As(err, &fe) || errors.Is(err, ErrTrailingData)
+}
+
+// WriteMessage serializes m with spec and writes it as one frame
+func WriteMessage(w io.Writer, framer Framer, spec *Spec, m *Iso8583Message, header []byte) error {
+	var buf bytes.Buffer
+	if err := m.Serialize(spec, &buf); err != nil {
+		return err
+	}
+	return framer.WriteFrame(w, &Frame{Header: header, Data: buf.Bytes()})
+}
@@ -0,0 +1,130 @@
+package iso8583
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestFramers(t *testing.T) {
+	tests := []struct {
+		framer *LengthFramer
+		header []byte
+		prefix []byte
+	}{
+		{NewBinaryFramer(), nil, []byte{0x00, 0x03}},
+		{NewASCIIFramer(), nil, []byte("0003")},
+		{NewTPDUFramer(), []byte{0x60, 0x00, 0x01, 0x00, 0x02}, []byte{0x00, 0x08, 0x60, 0x00, 0x01, 0x00, 0x02}},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		for i := 0; i < 2; i++ {
+			if err := tt.framer.WriteFrame(&buf, &Frame{Header: tt.header, Data: []byte("abc")}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.HasPrefix(buf.Bytes(), tt.prefix) {
+			t.Errorf("got %X, want prefix %X", buf.Bytes(), tt.prefix)
+		}
+
+		for i := 0; i < 2; i++ {
+			f, err := tt.framer.ReadFrame(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(f.Data) != "abc" || !bytes.Equal(f.Header, tt.header) {
+				t.Errorf("got header %X data %q", f.Header, f.Data)
+			}
+		}
+		if _, err := tt.framer.ReadFrame(&buf); err != io.EOF {
+			t.Errorf("got %v, want io.EOF", err)
+		}
+	}
+}
+
+func TestFrameErrors(t *testing.T) {
+	framer := NewBinaryFramer()
+	framer.MaxSize = 16
+
+	if err := framer.WriteFrame(io.Discard, &Frame{Data: make([]byte, 17)}); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("write: got %v, want %v", err, ErrFrameTooLarge)
+	}
+	if _, err := framer.ReadFrame(bytes.NewReader([]byte{0x00, 0x11})); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("read: got %v, want %v", err, ErrFrameTooLarge)
+	}
+	if _, err := framer.ReadFrame(bytes.NewReader([]byte{0x00, 0x05, 'a'})); err != ErrShortRead {
+		t.Errorf("truncated: got %v, want %v", err, ErrShortRead)
+	}
+	if _, err := NewASCIIFramer().ReadFrame(bytes.NewReader([]byte("00x5abcde"))); err != ErrBadFrame {
+		t.Errorf("ascii: got %v, want %v", err, ErrBadFrame)
+	}
+	if _, err := NewTPDUFramer().ReadFrame(bytes.NewReader([]byte{0x00, 0x03, 1, 2, 3})); err != ErrBadFrame {
+		t.Errorf("tpdu: got %v, want %v", err, ErrBadFrame)
+	}
+	if err := NewTPDUFramer().WriteFrame(io.Discard, &Frame{Data: []byte("abc")}); err == nil {
+		t.Error("frame without TPDU was written")
+	}
+
+	// the length prefix caps MaxSize
+	short := &LengthFramer{LenSize: 2, ASCII: true, MaxSize: 1000}
+	if err := short.WriteFrame(io.Discard, &Frame{Data: make([]byte, 150)}); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("ascii 2: got %v, want %v", err, ErrFrameTooLarge)
+	}
+	if err := short.WriteFrame(io.Discard, &Frame{Data: make([]byte, 99)}); err != nil {
+		t.Errorf("ascii 2: %v", err)
+	}
+	wide := &LengthFramer{LenSize: 2, MaxSize: 100000}
+	if err := wide.WriteFrame(io.Discard, &Frame{Data: make([]byte, 65536)}); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("binary 2: got %v, want %v", err, ErrFrameTooLarge)
+	}
+}
+
+func TestTrailingData(t *testing.T) {
+	spec := DefaultSpec()
+	framer := NewBinaryFramer()
+	var msg bytes.Buffer
+	if err := sampleMessage().Serialize(spec, &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	framer.WriteFrame(&buf, &Frame{Data: append(msg.Bytes(), 'x')})
+	framer.WriteFrame(&buf, &Frame{Data: msg.Bytes()})
+	if _, _, err := ReadMessage(&buf, framer, spec); !errors.Is(err, ErrTrailingData) || !isMessageError(err) {
+		t.Errorf("got %v, want %v", err, ErrTrailingData)
+	}
+	if _, _, err := ReadMessage(&buf, framer, spec); err != nil {
+		t.Errorf("next frame: %v", err)
+	}
+}
+
+func TestMessageOverConn(t *testing.T) {
+	spec := DefaultSpec()
+	framer := NewTPDUFramer()
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	tpdu := TPDU{ID: 0x60, Destination: 0x0001, Source: 0x0203}
+	go func() {
+		WriteMessage(client, framer, spec, sampleMessage(), tpdu.Bytes())
+	}()
+
+	m, f, err := ReadMessage(server, framer, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseTPDU(f.Header)
+	if err != nil || got != tpdu {
+		t.Errorf("got TPDU %+v %v, want %+v", got, err, tpdu)
+	}
+	if got.Reply() != (TPDU{ID: 0x60, Destination: 0x0203, Source: 0x0001}) {
+		t.Errorf("got reply %+v", got.Reply())
+	}
+	if m.Get(CardNo) != "4111111111111111" {
+		t.Errorf("got PAN %q", m.Get(CardNo))
+	}
+}
@@ -4,160 +4,252 @@
 package iso8583
 
 import (
-	"bufio"
-	"bytes"
+	"io"
+	"strings"
 )
 
 type IField interface {
-	Read(r *bufio.Reader) string
-	Write(w *bufio.Writer, s string)
+	Read(r io.Reader) (string, error)
+	Write(w io.Writer, s string) error
 }
 
-var Fields [128]IField
-
+// Field is a fixed length field
 type Field struct {
-	Type   string
-	Length int
+	Type     string
+	Length   int
+	Enc      Encoder // value encoding, ASCII if nil
+	PadRight bool    // pad short values on the right instead of the left
 }
 
+// LLField is a variable length field with a 2 digit length indicator
 type LLField struct {
 	Type   string
 	Length int
+	Enc    Encoder // value encoding, ASCII if nil
+	LenEnc Encoder // length indicator encoding, ASCII if nil
 }
 
+// LLLField is a variable length field with a 3 digit length indicator
 type LLLField struct {
 	Type   string
 	Length int
+	Enc    Encoder // value encoding, ASCII if nil
+	LenEnc Encoder // length indicator encoding, ASCII if nil
 }
 
-func (f *Field) Read(r *bufio.Reader) string {
-	buf := make([]byte, f.Length)
-	//io.ReadFull(r, buf)
-	if f.Type[0] == 'n' {
-		i := 0
-		for i < len(buf) && buf[i] == '0' {
-			i++
-		}
-		return string(buf[i:])
+// LLLLField is a variable length field with a 4 digit length indicator
+type LLLLField struct {
+	Type   string
+	Length int
+	Enc    Encoder // value encoding, ASCII if nil
+	LenEnc Encoder // length indicator encoding, ASCII if nil
+}
+
+func (f *Field) Read(r io.Reader) (string, error) {
+	enc := orASCII(f.Enc)
+	buf := make([]byte, enc.Size(f.Length))
+	if err := readFull(r, buf); err != nil {
+		return "", err
+	}
+	s, err := enc.Decode(buf, f.Length)
+	if err != nil {
+		return "", err
 	}
 
-	return string(bytes.Trim(buf, " "))
+	switch {
+	case f.Type[0] == 'b':
+		return s, nil
+	case f.PadRight:
+		return strings.TrimRight(s, string(padByte(f.Type))), nil
+	case f.Type[0] == 'n':
+		return strings.TrimLeft(s, "0"), nil
+	}
+	return strings.Trim(s, " "), nil
 }
 
-func (f *LLField) Read(r *bufio.Reader) string {
-	lenbuf := make([]byte, 2)
-	r.Read(lenbuf)
-	vlen := int(lenbuf[0] - '0')
-	vlen = vlen*10 + int(lenbuf[1]-'0')
-
-	buf := make([]byte, vlen)
-	r.Read(buf)
-	return string(buf)
+func (f *LLField) Read(r io.Reader) (string, error) {
+	return readVar(r, 2, f.Length, orASCII(f.LenEnc), orASCII(f.Enc))
 }
 
-func (f *LLLField) Read(r *bufio.Reader) string {
-	lenbuf := make([]byte, 3)
-	r.Read(lenbuf)
-	vlen := int(lenbuf[0] - '0')
-	vlen = vlen*10 + int(lenbuf[1]-'0')
-	vlen = vlen*10 + int(lenbuf[2]-'0')
+func (f *LLLField) Read(r io.Reader) (string, error) {
+	return readVar(r, 3, f.Length, orASCII(f.LenEnc), orASCII(f.Enc))
+}
 
-	buf := make([]byte, vlen)
-	r.Read(buf)
-	return string(buf)
+func (f *LLLLField) Read(r io.Reader) (string, error) {
+	return readVar(r, 4, f.Length, orASCII(f.LenEnc), orASCII(f.Enc))
 }
 
 // Write functions
-func (f *Field) Write(w *bufio.Writer, s string) {
-	if len(s) > f.Length {
-		buf := make([]byte, f.Length)
-		for i := 0; i < f.Length; i++ {
-			buf[i] = s[i]
-		}
-		w.Write(buf)
-	} else {
-		pad := byte(' ')
-		if f.Type[0] == 'n' {
-			pad = '0'
-		}
-		buf := make([]byte, f.Length-len(s))
-		for i := 0; i < f.Length-len(s); i++ {
-			buf[i] = pad
+func (f *Field) Write(w io.Writer, s string) error {
+	enc := orASCII(f.Enc)
+	if n := charLen(enc, s); n > f.Length {
+		s = truncate(enc, s, f.Length)
+	} else if n < f.Length {
+		pad := strings.Repeat(string(padByte(f.Type)), f.Length-n)
+		if f.PadRight {
+			s += pad
+		} else {
+			s = pad + s
 		}
-		w.Write(buf)
-		w.WriteString(s)
 	}
+
+	buf, err := enc.Encode(s)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
 }
 
-func (f *LLField) Write(w *bufio.Writer, s string) {
-	l := len(s)
+func (f *LLField) Write(w io.Writer, s string) error {
+	return writeVar(w, 2, f.Length, orASCII(f.LenEnc), orASCII(f.Enc), s)
+}
 
-	lenbuf := make([]byte, 2)
-	// length header
-	lenbuf[0] = byte(l / 10)
-	lenbuf[1] = byte(l % 10)
-	// data
-	w.Write(lenbuf)
-	w.WriteString(s)
+func (f *LLLField) Write(w io.Writer, s string) error {
+	return writeVar(w, 3, f.Length, orASCII(f.LenEnc), orASCII(f.Enc), s)
 }
 
-func (f *LLLField) Write(w *bufio.Writer, s string) {
-	l := len(s)
+func (f *LLLLField) Write(w io.Writer, s string) error {
+	return writeVar(w, 4, f.Length, orASCII(f.LenEnc), orASCII(f.Enc), s)
+}
 
-	lenbuf := make([]byte, 3)
-	// length header
-	lenbuf[0] = byte(l / 100)
-	lenbuf[1] = byte((l / 100) / 10)
-	lenbuf[2] = byte((l / 100) % 10)
-	// data
-	w.Write(lenbuf)
-	w.WriteString(s)
+// padByte returns the filler used for short fixed length values
+func padByte(typ string) byte {
+	switch typ[0] {
+	case 'n':
+		return '0'
+	case 'b':
+		return 0
+	}
+	return ' '
+}
+
+func orASCII(enc Encoder) Encoder {
+	if enc == nil {
+		return ASCII
+	}
+	return enc
 }
 
-func InitFieldTypes() {
-	Fields[CardNo] = &LLField{"s..", 19}
-	Fields[ProcCode] = &Field{"n", 6}
-	Fields[AMOUNT] = &Field{"n", 12}
-	Fields[TrxDate] = &Field{"n", 10}
-	Fields[TraceNo] = &Field{"n", 6}
-	Fields[LocalTime] = &Field{"n", 6}
-	Fields[LocalDate] = &Field{"n", 4}
-	Fields[15] = &Field{"n", 4}
-	Fields[18] = &Field{"n", 4}
-	Fields[22] = &Field{"n", 3}
-	Fields[25] = &Field{"n", 2}
-	Fields[26] = &Field{"n", 2}
-	Fields[32] = &LLField{"n..", 11}
-	Fields[33] = &LLField{"n..", 11}
-	Fields[35] = &LLField{"n..", 37}
-	Fields[36] = &LLLField{"ans...", 104}
-	Fields[37] = &Field{"s", 12}
-	Fields[38] = &Field{"s", 6}
-	Fields[ResponseCode] = &Field{"s", 2}
-	Fields[41] = &Field{"s", 8}
-	Fields[42] = &Field{"s", 15}
-	Fields[43] = &Field{"s", 40}
-	Fields[44] = &LLLField{"ans..", 25}
-	Fields[48] = &LLLField{"ans...", 999}
-	Fields[CURRENCY] = &Field{"s", 3}
-	Fields[52] = &Field{"n", 16}
-	Fields[53] = &Field{"n", 16}
-	Fields[54] = &LLLField{"ans...", 120}
-	Fields[60] = &LLLField{"ans...", 999}
-	Fields[61] = &LLLField{"ans...", 999}
-	Fields[62] = &LLLField{"ans...", 999}
-	Fields[63] = &LLLField{"ans...", 999}
-	Fields[90] = &Field{"n", 42}
-	Fields[95] = &Field{"s", 42}
-	Fields[Account1] = &LLField{"ans..", 30}
-	Fields[Account2] = &LLField{"ans..", 30}
+// readFull fills buf, reporting any kind of EOF as ErrShortRead
+func readFull(r io.Reader, buf []byte) error {
+	_, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrShortRead
+	}
+	return err
+}
+
+// readVar reads a value prefixed by a length indicator of 'digits' digits
+func readVar(r io.Reader, digits, max int, lenEnc, enc Encoder) (string, error) {
+	lenbuf := make([]byte, lengthSize(lenEnc, digits))
+	if err := readFull(r, lenbuf); err != nil {
+		return "", err
+	}
+	vlen, err := decodeLength(lenEnc, lenbuf, digits)
+	if err != nil {
+		return "", err
+	}
+	if vlen > max {
+		return "", ErrLengthTooLong
+	}
+
+	buf := make([]byte, enc.Size(vlen))
+	if err := readFull(r, buf); err != nil {
+		return "", err
+	}
+	return enc.Decode(buf, vlen)
+}
+
+// writeVar writes s prefixed by a length indicator of 'digits' digits
+func writeVar(w io.Writer, digits, max int, lenEnc, enc Encoder, s string) error {
+	l := charLen(enc, s)
+	if l > max {
+		return ErrLengthTooLong
+	}
+
+	lenbuf, err := encodeLength(lenEnc, l, digits)
+	if err != nil {
+		return err
+	}
+	buf, err := enc.Encode(s)
+	if err != nil {
+		return err
+	}
+	// length header and data in one write
+	_, err = w.Write(append(lenbuf, buf...))
+	return err
+}
+
+// DefaultSpec returns a new copy of the built-in field layout
+func DefaultSpec() *Spec {
+	s := NewSpec("default")
+	s.Names = isoNames
+	fields := &s.Fields
+
+	fields[CardNo] = &LLField{Type: "n..", Length: 19}
+	fields[ProcCode] = &Field{Type: "n", Length: 6}
+	fields[AMOUNT] = &Field{Type: "n", Length: 12}
+	fields[TrxDate] = &Field{Type: "n", Length: 10}
+	fields[TraceNo] = &Field{Type: "n", Length: 6}
+	fields[LocalTime] = &Field{Type: "n", Length: 6}
+	fields[LocalDate] = &Field{Type: "n", Length: 4}
+	fields[15] = &Field{Type: "n", Length: 4}
+	fields[18] = &Field{Type: "n", Length: 4}
+	fields[22] = &Field{Type: "n", Length: 3}
+	fields[25] = &Field{Type: "n", Length: 2}
+	fields[26] = &Field{Type: "n", Length: 2}
+	fields[TranFeeAmount] = &Field{Type: "an", Length: 9}
+	fields[_030_TRAN_PROC_FEE_AMOUNT] = &Field{Type: "an", Length: 9}
+	fields[32] = &LLField{Type: "n..", Length: 11}
+	fields[33] = &LLField{Type: "n..", Length: 11}
+	fields[35] = &LLField{Type: "z..", Length: 37}
+	fields[36] = &LLLField{Type: "ans...", Length: 104}
+	fields[37] = &Field{Type: "an", Length: 12}
+	fields[38] = &Field{Type: "an", Length: 6}
+	fields[ResponseCode] = &Field{Type: "an", Length: 2}
+	fields[41] = &Field{Type: "ans", Length: 8}
+	fields[42] = &Field{Type: "ans", Length: 15}
+	fields[43] = &Field{Type: "ans", Length: 40}
+	fields[44] = &LLLField{Type: "ans..", Length: 25}
+	fields[48] = &LLLField{Type: "ans...", Length: 999}
+	fields[CURRENCY] = &Field{Type: "an", Length: 3}
+	fields[52] = &Field{Type: "b", Length: 8, Enc: Binary}
+	fields[53] = &Field{Type: "n", Length: 16}
+	fields[54] = &LLLField{Type: "ans...", Length: 120}
+	fields[55] = &LLLField{Type: "b...", Length: 255, Enc: Binary}
+	fields[60] = &LLLField{Type: "ans...", Length: 999}
+	fields[61] = &LLLField{Type: "ans...", Length: 999}
+	fields[62] = &LLLField{Type: "ans...", Length: 999}
+	fields[63] = &LLLField{Type: "ans...", Length: 999}
+	fields[64] = &Field{Type: "b", Length: 8, Enc: Binary}
+	fields[SettleCode] = &Field{Type: "n", Length: 1}
+	fields[70] = &Field{Type: "n", Length: 3}
+	for no := uint(74); no <= 81; no++ {
+		fields[no] = &Field{Type: "n", Length: 10}
+	}
+	for no := uint(82); no <= 85; no++ {
+		fields[no] = &Field{Type: "n", Length: 12}
+	}
+	for no := uint(86); no <= 89; no++ {
+		fields[no] = &Field{Type: "n", Length: 16}
+	}
+	fields[90] = &Field{Type: "n", Length: 42}
+	fields[95] = &Field{Type: "an", Length: 42}
+	fields[97] = &Field{Type: "an", Length: 17}
+	fields[99] = &LLField{Type: "n..", Length: 11}
+	fields[Account1] = &LLField{Type: "ans..", Length: 30}
+	fields[Account2] = &LLField{Type: "ans..", Length: 30}
+	fields[128] = &Field{Type: "b", Length: 8, Enc: Binary}
+
+	return s
 }
 
 // Field numbers
 const (
-	MTI    = 0
-	Bitmap = 1
-	CardNo = 2
+	MessageType = 0
+	Bitmap      = 1
+	CardNo      = 2
 	// Processing Code
 	ProcCode = 3
 	// Transaction Amount
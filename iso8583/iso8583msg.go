@@ -3,113 +3,236 @@
 // Package iso8583 implements a fast ISO 8583 decoder
 package iso8583
 
-import "bufio"
+import (
+	"bytes"
+	"io"
+)
 
 type Iso8583Message struct {
-	Mti    string
-	Bitmap [128]bool
+	Mti    MTI
+	Bitmap [MaxField]bool
 	// internal fields
-	values [128]string
+	values [MaxField + 1]string
+	sub    map[uint]map[string]string // subfields of composite fields
 }
 
 func (m *Iso8583Message) Set(no uint, value string) {
 	if no == 0 {
-		m.Mti = value
+		m.Mti = MTI(value)
+		return
 	}
 	m.values[no] = value
 	m.Bitmap[no-1] = true
+	delete(m.sub, no)
 }
 
 func (m *Iso8583Message) Unset(no uint) {
-	m.Bitmap[no-1] = true
+	if no == 0 {
+		m.Mti = ""
+		return
+	}
+	m.Bitmap[no-1] = false
 	m.values[no] = ""
+	delete(m.sub, no)
 }
 
 func (m *Iso8583Message) Get(no uint) string {
+	if no == 0 {
+		return string(m.Mti)
+	}
 	return m.values[no]
 }
 
 func (m *Iso8583Message) Clear() {
-	m.Mti = ""
+	*m = Iso8583Message{}
 }
 
-func (m *Iso8583Message) Parse(r *bufio.Reader) {
-	// read MTI
-	mtiBuf := make([]byte, 4)
-	//io.ReadFull(r, mtiBuf)
-	m.Mti = string(mtiBuf)
-
-	// read bitmap
-	bitmap := make([]byte, 8)
-	//io.ReadFull(r, bitmap)
-	if bitmap[0]&0x80 == 0x80 {
-		bitmap2 := make([]byte, 8)
-		//io.ReadFull(r, bitmap2)
-		bitmap = append(bitmap, bitmap2...)
-	}
-
-	b := byte(0)
-	bitIndex := byte(0x80)
-	pos := 0
-	for i := 0; i < len(bitmap); i++ {
-		bitIndex = 0x80
-		b = bitmap[i]
-		for bitIndex > 0 {
-			if b&bitIndex != 0 {
-				m.Bitmap[pos] = true
-			}
+// Parse reads a message using the field definitions of spec.
+// A stream that ends before the message starts returns io.EOF,
+// any other failure is reported as a *FieldError.
+func (m *Iso8583Message) Parse(spec *Spec, r io.Reader) error {
+	m.Clear()
+	var raw bytes.Buffer
+	if spec.MAC != nil {
+		r = io.TeeReader(r, &raw)
+	}
+	cr := &countingReader{r: r}
 
-			bitIndex >>= 1
-			pos++
+	// read MTI
+	mtiEnc := orASCII(spec.MtiEnc)
+	mtiBuf := make([]byte, mtiEnc.Size(4))
+	if _, err := io.ReadFull(cr, mtiBuf); err != nil {
+		if err == io.EOF {
+			return err
+		}
+		if err == io.ErrUnexpectedEOF {
+			err = ErrShortRead
+		}
+		return &FieldError{0, 0, err}
+	}
+	mti, err := mtiEnc.Decode(mtiBuf, 4)
+	if err == nil {
+		err = spec.ValidateMTI(MTI(mti))
+	}
+	if err != nil {
+		return &FieldError{0, 0, err}
+	}
+	m.Mti = MTI(mti)
+
+	// read bitmaps, bit 1 announces the secondary and
+	// bit 65 the tertiary bitmap
+	enc := spec.Bitmap
+	blocks := 1
+	for i := 0; i < blocks; i++ {
+		offset := cr.n
+		buf := make([]byte, enc.blockSize())
+		if err := readFull(cr, buf); err != nil {
+			return &FieldError{1, offset, err}
+		}
+		bits := m.Bitmap[i*64 : (i+1)*64]
+		if err := enc.decode(buf, bits); err != nil {
+			return &FieldError{1, offset, err}
+		}
+		if i < 2 && bits[0] {
+			blocks++
 		}
 	}
 
 	// read fields
-	for j := uint(2); j < uint(pos); j++ {
-		if m.Bitmap[j-1] {
-			m.Set(j, Fields[j].Read(r))
+	macOffset := int64(-1)
+	for j := uint(2); j <= uint(blocks*64); j++ {
+		if !m.Bitmap[j-1] || j == 65 {
+			continue
+		}
+		offset := cr.n
+		macOffset = offset
+		f := spec.Field(j)
+		if f == nil {
+			return &FieldError{j, offset, ErrNoField}
+		}
+		v, err := f.Read(cr)
+		if err != nil {
+			return &FieldError{j, offset, err}
 		}
+		m.Set(j, v)
+
+		if c, ok := f.(*CompositeField); ok {
+			sub, err := c.Unpack(v)
+			if err != nil {
+				return &FieldError{j, offset, err}
+			}
+			if m.sub == nil {
+				m.sub = make(map[uint]map[string]string)
+			}
+			m.sub[j] = sub
+		}
+	}
+
+	if spec.MAC != nil {
+		no := uint(blocks * 64)
+		if !m.Bitmap[no-1] {
+			return &FieldError{no, cr.n, ErrNoMAC}
+		}
+		return checkMAC(spec.MAC, raw.Bytes()[:macOffset], m.Get(no), no, macOffset)
 	}
+	return nil
 }
 
-func (m *Iso8583Message) Serialize(w *bufio.Writer) {
-	// write mti
-	w.WriteString(m.Mti)
+// Serialize writes a message using the field definitions of spec.
+// In strict mode the message is checked against spec.Rules, then all
+// values are validated and the first invalid one is reported as a
+// *ValidationError.
+func (m *Iso8583Message) Serialize(spec *Spec, w io.Writer) error {
+	if spec.Strict {
+		if err := spec.ValidateMTI(m.Mti); err != nil {
+			return &FieldError{0, 0, err}
+		}
+		if spec.Rules != nil {
+			if err := spec.Rules.Validate(spec, m); err != nil {
+				return err
+			}
+		}
+		for i := uint(2); i <= MaxField; i++ {
+			if !m.Bitmap[i-1] || i == 65 {
+				continue
+			}
+			if err := spec.Validate(i, m.Get(i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw := &countingWriter{w: w}
 
-	// write bitmap
-	bmpLen := uint(64)
-	t := 64
-	for t < 128 && m.Bitmap[t] == false {
-		t++
+	// write mti
+	mti, err := orASCII(spec.MtiEnc).Encode(string(m.Mti))
+	if err == nil {
+		_, err = cw.Write(mti)
 	}
-	if t < 128 {
-		bmpLen = 128
+	if err != nil {
+		return &FieldError{0, 0, err}
 	}
 
-	bmp := make([]byte, bmpLen)
-
-	bitIndex := byte(0x80)
-	b := byte(0)
-	pos := 0
-	for i := uint(0); i < bmpLen; i++ {
-		if m.Bitmap[i] {
-			b |= bitIndex
-		}
-		bitIndex >>= 1
-		if bitIndex == 0 {
-			bmp[pos] = b
-			pos++
-			bitIndex = 0x80
-			b = 0
-		}
+	// write bitmaps
+	blocks := m.bitmapBlocks()
+	bmp := make([]byte, 0, blocks*spec.Bitmap.blockSize())
+	for i := 0; i < blocks; i++ {
+		bmp = append(bmp, spec.Bitmap.encode(m.Bitmap[i*64:(i+1)*64])...)
 	}
 
-	w.Write(bmp[:bmpLen])
+	offset := cw.n
+	if _, err := cw.Write(bmp); err != nil {
+		return &FieldError{1, offset, err}
+	}
 
 	// write fields
-	for i := uint(2); i < bmpLen; i++ {
-		if m.Bitmap[i-1] {
-			Fields[i].Write(w, m.Get(i))
+	for i := uint(2); i <= uint(blocks*64); i++ {
+		if !m.Bitmap[i-1] || i == 65 {
+			continue
+		}
+		offset = cw.n
+		f := spec.Field(i)
+		if f == nil {
+			return &FieldError{i, offset, ErrNoField}
+		}
+		v := m.Get(i)
+		if m.sub[i] != nil {
+			c, ok := f.(*CompositeField)
+			if !ok {
+				return &FieldError{i, offset, ErrNotComposite}
+			}
+			if v, err = c.Pack(m.sub[i]); err != nil {
+				return &FieldError{i, offset, err}
+			}
+		}
+		if err := f.Write(cw, v); err != nil {
+			return &FieldError{i, offset, err}
 		}
 	}
+
+	return nil
+}
+
+// countingReader keeps track of the number of bytes consumed
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter keeps track of the number of bytes written
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
 }
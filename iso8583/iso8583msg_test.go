@@ -0,0 +1,125 @@
+package iso8583
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func sampleMessage() *Iso8583Message {
+	msg := new(Iso8583Message)
+	msg.Mti = "0200"
+	msg.Set(CardNo, "4111111111111111")
+	msg.Set(ProcCode, "1")
+	msg.Set(AMOUNT, "1500")
+	msg.Set(TraceNo, "123")
+	msg.Set(RefNo, "1762745214")
+	msg.Set(ResponseCode, "00")
+	msg.Set(AdditionalData, "01000abcdefghijkl")
+	msg.Set(Account1, "5001234567")
+	return msg
+}
+
+func TestRoundTrip(t *testing.T) {
+	spec := DefaultSpec()
+	msg := sampleMessage()
+
+	var buf bytes.Buffer
+	if err := msg.Serialize(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(Iso8583Message)
+	if err := got.Parse(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got.Mti != msg.Mti {
+		t.Errorf("mti: got %q, want %q", got.Mti, msg.Mti)
+	}
+	for no := uint(2); no <= MaxField; no++ {
+		if got.Get(no) != msg.Get(no) || got.Bitmap[no-1] != msg.Bitmap[no-1] {
+			t.Errorf("field %d: got %q, want %q", no, got.Get(no), msg.Get(no))
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("%d bytes left unread", buf.Len())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	spec := DefaultSpec()
+	var buf bytes.Buffer
+	if err := sampleMessage().Serialize(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// MTI + primary + secondary bitmap
+	pan := 4 + 16
+
+	badLen := append([]byte{}, data...)
+	badLen[pan] = 'x'
+
+	tooLong := append([]byte{}, data...)
+	tooLong[pan], tooLong[pan+1] = '2', '0'
+
+	tests := []struct {
+		name   string
+		data   []byte
+		field  uint
+		offset int64
+		err    error
+	}{
+		{"mti", data[:2], 0, 0, ErrShortRead},
+		{"bitmap", data[:10], 1, 4, ErrShortRead},
+		{"truncated", data[:pan+5], CardNo, int64(pan), ErrShortRead},
+		{"length digits", badLen, CardNo, int64(pan), ErrBadLength},
+		{"length max", tooLong, CardNo, int64(pan), ErrLengthTooLong},
+		{"last field", data[:len(data)-1], Account1, int64(len(data) - 12), ErrShortRead},
+	}
+
+	for _, tt := range tests {
+		err := new(Iso8583Message).Parse(spec, bytes.NewReader(tt.data))
+		var fe *FieldError
+		if !errors.As(err, &fe) {
+			t.Errorf("%s: got %v, want *FieldError", tt.name, err)
+			continue
+		}
+		if fe.Field != tt.field || fe.Offset != tt.offset || fe.Err != tt.err {
+			t.Errorf("%s: got %v, want field %d at offset %d: %v", tt.name, err, tt.field, tt.offset, tt.err)
+		}
+	}
+
+	if err := new(Iso8583Message).Parse(spec, bytes.NewReader(nil)); err != io.EOF {
+		t.Errorf("empty input: got %v, want io.EOF", err)
+	}
+}
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestSerializeErrors(t *testing.T) {
+	spec := DefaultSpec()
+
+	if err := sampleMessage().Serialize(spec, failWriter{}); err == nil {
+		t.Error("write failure was not reported")
+	}
+
+	msg := sampleMessage()
+	msg.Set(CardNo, "41111111111111111111")
+	err := msg.Serialize(spec, io.Discard)
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Field != CardNo || fe.Err != ErrLengthTooLong {
+		t.Errorf("got %v, want field %d: %v", err, CardNo, ErrLengthTooLong)
+	}
+
+	msg = sampleMessage()
+	msg.Set(127, "x")
+	err = msg.Serialize(spec, io.Discard)
+	if !errors.As(err, &fe) || fe.Field != 127 || fe.Err != ErrNoField {
+		t.Errorf("got %v, want field 127: %v", err, ErrNoField)
+	}
+}
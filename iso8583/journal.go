@@ -0,0 +1,378 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrJournalClosed is returned for records written after Close
+var ErrJournalClosed = errors.New("iso8583: journal closed")
+
+// DefaultSegmentSize is the size at which journal segments are rotated
+const DefaultSegmentSize = 64 << 20
+
+// Direction tells whether a message was received or sent
+type Direction byte
+
+const (
+	Inbound  Direction = 'I'
+	Outbound Direction = 'O'
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Inbound:
+		return "in"
+	case Outbound:
+		return "out"
+	}
+	return fmt.Sprintf("Direction(%d)", byte(d))
+}
+
+// JournalEntry is one recorded message
+type JournalEntry struct {
+	Time      time.Time
+	Direction Direction
+	ConnID    string
+	Raw       []byte // the message as on the wire, without framing
+}
+
+// Message parses the raw bytes of the entry
+func (e *JournalEntry) Message(spec *Spec) (*Iso8583Message, error) {
+	m := new(Iso8583Message)
+	if err := m.Parse(spec, bytes.NewReader(e.Raw)); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Journal is an append only record of traffic, kept in numbered segment
+// files in one directory. Every Open starts a new segment, so a torn
+// record left by a crash is never written after.
+//
+// A record is a 4 byte big endian length, the CRC-32 of the rest, the
+// time in Unix nanoseconds (8 bytes), the direction, the length of the
+// connection ID (1 byte), the connection ID and the raw message.
+type Journal struct {
+	SegmentSize int64 // rotate after this many bytes, DefaultSegmentSize if 0
+	Sync        bool  // flush every record to disk
+
+	dir  string
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	seq  int
+}
+
+// OpenJournal opens the journal in dir, creating it if needed
+func OpenJournal(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	segs, err := segments(dir)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{dir: dir}
+	if len(segs) > 0 {
+		j.seq = segs[len(segs)-1].seq
+	}
+	if err := j.rotate(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+type segment struct {
+	seq  int
+	path string
+}
+
+// segments lists the segment files of dir in order
+func segments(dir string) ([]segment, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "journal-*.log"))
+	if err != nil {
+		return nil, err
+	}
+	var segs []segment
+	for _, name := range names {
+		var seq int
+		if _, err := fmt.Sscanf(filepath.Base(name), "journal-%d.log", &seq); err == nil {
+			segs = append(segs, segment{seq, name})
+		}
+	}
+	sort.Slice(segs, func(i, j int) bool { return segs[i].seq < segs[j].seq })
+	return segs, nil
+}
+
+func (j *Journal) rotate() error {
+	if j.f != nil {
+		if err := j.f.Close(); err != nil {
+			return err
+		}
+	}
+	j.seq++
+	name := filepath.Join(j.dir, fmt.Sprintf("journal-%08d.log", j.seq))
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0600)
+	if err != nil {
+		j.f = nil
+		return err
+	}
+	j.f, j.size = f, 0
+	return nil
+}
+
+// Record appends a message with the current time
+func (j *Journal) Record(d Direction, connID string, raw []byte) error {
+	return j.record(time.Now(), d, connID, raw)
+}
+
+func (j *Journal) record(t time.Time, d Direction, connID string, raw []byte) error {
+	if len(connID) > 255 {
+		connID = connID[:255]
+	}
+	rec := make([]byte, 16, 16+2+len(connID)+len(raw))
+	binary.BigEndian.PutUint64(rec[8:], uint64(t.UnixNano()))
+	rec = append(rec, byte(d), byte(len(connID)))
+	rec = append(rec, connID...)
+	rec = append(rec, raw...)
+	binary.BigEndian.PutUint32(rec, uint32(len(rec)-4))
+	binary.BigEndian.PutUint32(rec[4:], crc32.ChecksumIEEE(rec[8:]))
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return ErrJournalClosed
+	}
+	max := j.SegmentSize
+	if max <= 0 {
+		max = DefaultSegmentSize
+	}
+	if j.size > 0 && j.size+int64(len(rec)) > max {
+		if err := j.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := j.f.Write(rec)
+	j.size += int64(n)
+	if err == nil && j.Sync {
+		err = j.f.Sync()
+	}
+	return err
+}
+
+// RecordMessage serializes m with spec and records it
+func (j *Journal) RecordMessage(spec *Spec, d Direction, connID string, m *Iso8583Message) error {
+	var buf bytes.Buffer
+	if err := m.Serialize(spec, &buf); err != nil {
+		return err
+	}
+	return j.Record(d, connID, buf.Bytes())
+}
+
+// Close closes the current segment
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return ErrJournalClosed
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
+
+// Scan calls fn for the entries recorded in [from, to), in order. A zero
+// from or to leaves that end open. A record torn by a crash ends its
+// segment.
+func (j *Journal) Scan(from, to time.Time, fn func(e *JournalEntry) error) error {
+	segs, err := segments(j.dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range segs {
+		if err := scanSegment(s.path, from, to, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanSegment(path string, from, to time.Time, fn func(e *JournalEntry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	var hdr [8]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return nil
+		}
+		n := binary.BigEndian.Uint32(hdr[:])
+		if n < 4+8+2 || n > 1<<24 {
+			return nil
+		}
+		rec := make([]byte, n-4)
+		if _, err := io.ReadFull(r, rec); err != nil {
+			return nil
+		}
+		if crc32.ChecksumIEEE(rec) != binary.BigEndian.Uint32(hdr[4:]) {
+			return nil
+		}
+		idLen := int(rec[9])
+		if 10+idLen > len(rec) {
+			return nil
+		}
+		e := &JournalEntry{
+			Time:      time.Unix(0, int64(binary.BigEndian.Uint64(rec))),
+			Direction: Direction(rec[8]),
+			ConnID:    string(rec[10 : 10+idLen]),
+			Raw:       rec[10+idLen:],
+		}
+		if !from.IsZero() && e.Time.Before(from) || !to.IsZero() && !e.Time.Before(to) {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+// Replay parses the messages of direction d recorded in [from, to) and
+// passes them to fn in order
+func (j *Journal) Replay(spec *Spec, from, to time.Time, d Direction, fn func(m *Iso8583Message) error) error {
+	return j.Scan(from, to, func(e *JournalEntry) error {
+		if e.Direction != d {
+			return nil
+		}
+		m, err := e.Message(spec)
+		if err != nil {
+			return err
+		}
+		return fn(m)
+	})
+}
+
+// ReplayTo returns a Replay function handing requests to h, the responses
+// h builds are dropped
+func ReplayTo(h Handler) func(m *Iso8583Message) error {
+	return func(m *Iso8583Message) error {
+		resp, err := NewResponse(m)
+		if err != nil {
+			// not a request
+			return nil
+		}
+		h.ServeISO8583(resp, m)
+		return nil
+	}
+}
+
+// SendTo returns a Replay function sending requests to s, like a client
+// connected to a test host
+func SendTo(ctx context.Context, s Sender) func(m *Iso8583Message) error {
+	return func(m *Iso8583Message) error {
+		if m.Mti.IsResponse() {
+			return nil
+		}
+		_, err := s.Send(ctx, m)
+		return err
+	}
+}
+
+// JournalQuery selects entries by STAN (field 11), RRN (field 37) or PAN.
+// The PAN may be given in full or masked by MaskPAN. Empty criteria match
+// all, a zero From or To leaves the time window open.
+type JournalQuery struct {
+	STAN     string
+	RRN      string
+	PAN      string
+	From, To time.Time
+}
+
+// Search returns the entries matching q. Entries that do not parse with
+// spec are skipped.
+func (j *Journal) Search(spec *Spec, q JournalQuery) ([]*JournalEntry, error) {
+	stan := spec.padNumber(TraceNo, q.STAN)
+	pan := q.PAN
+	if pan != "" && !strings.Contains(pan, "*") {
+		pan = MaskPAN(pan)
+	}
+
+	var found []*JournalEntry
+	err := j.Scan(q.From, q.To, func(e *JournalEntry) error {
+		m, err := e.Message(spec)
+		if err != nil {
+			return nil
+		}
+		if q.STAN != "" && spec.Value(m, TraceNo) != stan ||
+			q.RRN != "" && strings.TrimSpace(m.Get(RefNo)) != q.RRN ||
+			pan != "" && MaskPAN(m.Get(CardNo)) != pan {
+			return nil
+		}
+		found = append(found, e)
+		return nil
+	})
+	return found, err
+}
+
+// JournalFramer records every frame read or written through Framer. The
+// connection ID is ConnID, or the remote address when the frames travel
+// over a net.Conn, so one JournalFramer can serve a whole Server.
+type JournalFramer struct {
+	Framer
+	Journal *Journal
+	ConnID  string
+	// OnError is called when a record cannot be written, the frame
+	// still goes through
+	OnError func(err error)
+}
+
+func (jf *JournalFramer) connID(rw interface{}) string {
+	if jf.ConnID != "" {
+		return jf.ConnID
+	}
+	if c, ok := rw.(net.Conn); ok {
+		return c.RemoteAddr().String()
+	}
+	return ""
+}
+
+func (jf *JournalFramer) ReadFrame(r io.Reader) (*Frame, error) {
+	f, err := jf.Framer.ReadFrame(r)
+	if err == nil {
+		jf.record(Inbound, jf.connID(r), f.Data)
+	}
+	return f, err
+}
+
+func (jf *JournalFramer) WriteFrame(w io.Writer, f *Frame) error {
+	if err := jf.Framer.WriteFrame(w, f); err != nil {
+		return err
+	}
+	jf.record(Outbound, jf.connID(w), f.Data)
+	return nil
+}
+
+func (jf *JournalFramer) record(d Direction, connID string, raw []byte) {
+	if err := jf.Journal.Record(d, connID, raw); err != nil && jf.OnError != nil {
+		jf.OnError(err)
+	}
+}
@@ -0,0 +1,123 @@
+package iso8583
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	dir := t.TempDir()
+	spec := DefaultSpec()
+	j, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.SegmentSize = 200
+
+	// traffic through a framer
+	var wire bytes.Buffer
+	framer := &JournalFramer{Framer: NewBinaryFramer(), Journal: j, ConnID: "pos-1"}
+	req := sampleMessage()
+	if err := WriteMessage(&wire, framer, spec, req, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ReadMessage(&wire, framer, spec); err != nil {
+		t.Fatal(err)
+	}
+
+	// recorded at known times
+	base := time.Date(2015, 6, 1, 9, 0, 0, 0, time.UTC)
+	for i, stan := range []string{"1", "2", "3"} {
+		m := sampleMessage()
+		m.Set(TraceNo, stan)
+		m.Set(RefNo, "RRN"+stan)
+		var buf bytes.Buffer
+		m.Serialize(spec, &buf)
+		if err := j.record(base.Add(time.Duration(i)*time.Minute), Inbound, "host", buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a restart starts a new segment after a torn record
+	segs, _ := segments(dir)
+	f, _ := os.OpenFile(segs[len(segs)-1].path, os.O_WRONLY|os.O_APPEND, 0)
+	f.Write([]byte{0, 0, 0, 50, 1, 2})
+	f.Close()
+	j, err = OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	other := sampleMessage()
+	other.Set(CardNo, "5500000000000004")
+	other.Set(TraceNo, "9")
+	if err := j.RecordMessage(spec, Outbound, "host", other); err != nil {
+		t.Fatal(err)
+	}
+
+	if segs, _ := segments(dir); len(segs) < 3 {
+		t.Errorf("%d segments, want rotation", len(segs))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "journal-00000001.log")); err != nil {
+		t.Error(err)
+	}
+
+	var all []*JournalEntry
+	j.Scan(time.Time{}, time.Time{}, func(e *JournalEntry) error {
+		all = append(all, e)
+		return nil
+	})
+	if len(all) != 6 {
+		t.Fatalf("scanned %d entries, want 6", len(all))
+	}
+	if all[0].Direction != Outbound || all[1].Direction != Inbound || all[0].ConnID != "pos-1" {
+		t.Errorf("first entries %v %s, %v", all[0].Direction, all[0].ConnID, all[1].Direction)
+	}
+	m, err := all[1].Message(spec)
+	if err != nil || m.Get(CardNo) != req.Get(CardNo) {
+		t.Errorf("entry message %v", err)
+	}
+
+	search := []struct {
+		q    JournalQuery
+		want int
+	}{
+		{JournalQuery{STAN: "000002"}, 1},
+		{JournalQuery{RRN: "RRN3"}, 1},
+		{JournalQuery{PAN: "411111******1111"}, 5},
+		{JournalQuery{PAN: "5500000000000004"}, 1},
+		{JournalQuery{PAN: "411111******1111", From: base, To: base.Add(2 * time.Minute)}, 2},
+		{JournalQuery{STAN: "7"}, 0},
+	}
+	for _, tt := range search {
+		found, err := j.Search(spec, tt.q)
+		if err != nil || len(found) != tt.want {
+			t.Errorf("%+v: found %d, %v, want %d", tt.q, len(found), err, tt.want)
+		}
+	}
+
+	// replay of a time window into a handler
+	var stans []string
+	h := HandlerFunc(func(resp, req *Iso8583Message) { stans = append(stans, req.Get(TraceNo)) })
+	if err := j.Replay(spec, base.Add(time.Minute), base.Add(time.Hour), Inbound, ReplayTo(h)); err != nil {
+		t.Fatal(err)
+	}
+	if len(stans) != 2 || stans[0] != "2" || stans[1] != "3" {
+		t.Errorf("replayed %v", stans)
+	}
+
+	s := &flakySender{acked: make(chan struct{}, 10)}
+	if err := j.Replay(spec, time.Time{}, base.Add(time.Minute), Inbound, SendTo(context.Background(), s)); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.mtis) != 1 {
+		t.Errorf("sent %v", s.mtis)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// jPOS GenericPackager file layout
+type jposPackager struct {
+	Fields     []jposField `xml:"isofield"`
+	Composites []jposField `xml:"isofieldpackager"`
+}
+
+type jposField struct {
+	ID     uint   `xml:"id,attr"`
+	Length int    `xml:"length,attr"`
+	Name   string `xml:"name,attr"`
+	Class  string `xml:"class,attr"`
+	Pad    bool   `xml:"pad,attr"`
+}
+
+// jposClass describes how a jPOS field class maps onto iso8583 fields
+type jposClass struct {
+	typ    string
+	digits int // length indicator digits, 0 for fixed fields
+	enc    Encoder
+	lenEnc Encoder
+}
+
+var jposClasses = map[string]jposClass{
+	"IF_CHAR":     {"ans", 0, ASCII, nil},
+	"IFA_CHAR":    {"ans", 0, ASCII, nil},
+	"IFA_NUMERIC": {"n", 0, ASCII, nil},
+	"IFA_AMOUNT":  {"ans", 0, ASCII, nil},
+	"IFA_LLNUM":   {"n", 2, ASCII, ASCII},
+	"IFA_LLLNUM":  {"n", 3, ASCII, ASCII},
+	"IFA_LLCHAR":  {"ans", 2, ASCII, ASCII},
+	"IFA_LLLCHAR": {"ans", 3, ASCII, ASCII},
+
+	"IFA_LLBINARY":  {"b", 2, Binary, ASCII},
+	"IFA_LLLBINARY": {"b", 3, Binary, ASCII},
+
+	"IFB_NUMERIC":   {"n", 0, BCD, nil},
+	"IFB_BINARY":    {"b", 0, Binary, nil},
+	"IFB_LLNUM":     {"n", 2, BCD, BCD},
+	"IFB_LLLNUM":    {"n", 3, BCD, BCD},
+	"IFB_LLCHAR":    {"ans", 2, ASCII, BCD},
+	"IFB_LLLCHAR":   {"ans", 3, ASCII, BCD},
+	"IFB_LLBINARY":  {"b", 2, Binary, BCD},
+	"IFB_LLLBINARY": {"b", 3, Binary, BCD},
+
+	"IFB_LLHNUM":     {"n", 2, BCD, Binary},
+	"IFB_LLHCHAR":    {"ans", 2, ASCII, Binary},
+	"IFB_LLHBINARY":  {"b", 2, Binary, Binary},
+	"IFB_LLLHBINARY": {"b", 3, Binary, Binary},
+
+	"IFE_CHAR":    {"ans", 0, EBCDIC, nil},
+	"IFE_NUMERIC": {"n", 0, EBCDIC, nil},
+	"IFE_LLNUM":   {"n", 2, EBCDIC, EBCDIC},
+	"IFE_LLLNUM":  {"n", 3, EBCDIC, EBCDIC},
+	"IFE_LLCHAR":  {"ans", 2, EBCDIC, EBCDIC},
+	"IFE_LLLCHAR": {"ans", 3, EBCDIC, EBCDIC},
+}
+
+var jposBitmaps = map[string]BitmapEncoding{
+	"IFA_BITMAP": BitmapHex,
+	"IFB_BITMAP": BitmapBinary,
+	"IFE_BITMAP": BitmapEBCDICHex,
+}
+
+// LoadGenericPackager builds a spec from a jPOS GenericPackager XML file
+func LoadGenericPackager(r io.Reader) (*Spec, error) {
+	var p jposPackager
+	if err := xml.NewDecoder(r).Decode(&p); err != nil {
+		return nil, err
+	}
+
+	spec := NewSpec("jpos")
+	// nested packagers are loaded as plain fields of their outer class
+	for _, f := range append(p.Fields, p.Composites...) {
+		if f.ID > MaxField {
+			return nil, fmt.Errorf("iso8583: field %d out of range", f.ID)
+		}
+
+		class := f.Class[strings.LastIndexByte(f.Class, '.')+1:]
+		if class == "IF_NOP" || f.ID == 65 {
+			// no data on the wire, bit 65 is the tertiary bitmap indicator
+			continue
+		}
+
+		if f.ID == 1 {
+			enc, ok := jposBitmaps[class]
+			if !ok {
+				return nil, fmt.Errorf("iso8583: field 1: unsupported bitmap class %s", class)
+			}
+			spec.Bitmap = enc
+			continue
+		}
+
+		c, ok := jposClasses[class]
+		if !ok {
+			return nil, fmt.Errorf("iso8583: field %d: unsupported class %s", f.ID, class)
+		}
+		if c.enc == BCD && !f.Pad {
+			c.enc = RightBCD
+		}
+
+		spec.Names[f.ID] = f.Name
+		if f.ID == 0 {
+			spec.MtiEnc = c.enc
+			continue
+		}
+
+		switch c.digits {
+		case 0:
+			spec.SetField(f.ID, &Field{Type: c.typ, Length: f.Length, Enc: c.enc})
+		case 2:
+			spec.SetField(f.ID, &LLField{Type: c.typ + "..", Length: f.Length, Enc: c.enc, LenEnc: c.lenEnc})
+		case 3:
+			spec.SetField(f.ID, &LLLField{Type: c.typ + "...", Length: f.Length, Enc: c.enc, LenEnc: c.lenEnc})
+		}
+	}
+
+	return spec, nil
+}
+
+// LoadGenericPackagerFile reads a jPOS GenericPackager XML file
+func LoadGenericPackagerFile(name string) (*Spec, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadGenericPackager(f)
+}
@@ -0,0 +1,82 @@
+package iso8583
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const jposSample = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<!DOCTYPE isopackager SYSTEM "genericpackager.dtd">
+<isopackager>
+  <isofield id="0" length="4" name="MESSAGE TYPE INDICATOR" class="org.jpos.iso.IFB_NUMERIC" pad="true"/>
+  <isofield id="1" length="16" name="BIT MAP" class="org.jpos.iso.IFA_BITMAP"/>
+  <isofield id="2" length="19" name="PAN - PRIMARY ACCOUNT NUMBER" class="org.jpos.iso.IFB_LLNUM" pad="false"/>
+  <isofield id="3" length="6" name="PROCESSING CODE" class="org.jpos.iso.IFB_NUMERIC" pad="true"/>
+  <isofield id="4" length="12" name="AMOUNT, TRANSACTION" class="org.jpos.iso.IFA_NUMERIC"/>
+  <isofield id="11" length="6" name="SYSTEM TRACE AUDIT NUMBER" class="org.jpos.iso.IFE_NUMERIC"/>
+  <isofield id="41" length="8" name="CARD ACCEPTOR TERMINAL IDENTIFICACION" class="org.jpos.iso.IFE_CHAR"/>
+  <isofield id="52" length="8" name="PIN DATA" class="org.jpos.iso.IFB_BINARY"/>
+  <isofield id="65" length="1" name="BITMAP, EXTENDED" class="org.jpos.iso.IFB_BINARY"/>
+  <isofieldpackager id="48" length="999" name="ADDITIONAL DATA" class="org.jpos.iso.IFA_LLLCHAR" packager="org.jpos.iso.packager.GenericSubFieldPackager">
+    <isofield id="0" length="3" name="TAG" class="org.jpos.iso.IFA_NUMERIC"/>
+  </isofieldpackager>
+  <isofield id="102" length="28" name="ACCOUNT IDENTIFICATION 1" class="org.jpos.iso.IFB_LLHCHAR"/>
+</isopackager>`
+
+func TestLoadGenericPackager(t *testing.T) {
+	spec, err := LoadGenericPackager(strings.NewReader(jposSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Bitmap != BitmapHex || spec.MtiEnc != BCD {
+		t.Errorf("got bitmap %d, mti %T", spec.Bitmap, spec.MtiEnc)
+	}
+	if spec.Names[2] != "PAN - PRIMARY ACCOUNT NUMBER" {
+		t.Errorf("name of field 2 = %q", spec.Names[2])
+	}
+	if f, ok := spec.Field(48).(*LLLField); !ok || f.Length != 999 {
+		t.Errorf("field 48 = %#v", spec.Field(48))
+	}
+
+	msg := new(Iso8583Message)
+	msg.Mti = "0200"
+	msg.Set(CardNo, "4111111111111")
+	msg.Set(ProcCode, "3000")
+	msg.Set(AMOUNT, "100")
+	msg.Set(TraceNo, "42")
+	msg.Set(TERMINAL, "TERM01")
+	msg.Set(PinData, "\x01\x02\x03\x04\x05\x06\x07\x08")
+	msg.Set(Account1, "ACC1")
+
+	var buf bytes.Buffer
+	if err := msg.Serialize(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x02, 0x00}
+	want = append(want, "F020000000801000"...)
+	if !bytes.HasPrefix(buf.Bytes(), want) {
+		t.Errorf("header %X, want %X", buf.Bytes()[:18], want)
+	}
+	// BCD length 13 and right padded PAN
+	pan := buf.Bytes()[2+32:]
+	if !bytes.HasPrefix(pan, []byte{0x13, 0x41, 0x11, 0x11, 0x11, 0x11, 0x11, 0x10}) {
+		t.Errorf("PAN %X", pan[:8])
+	}
+
+	got := new(Iso8583Message)
+	if err := got.Parse(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Error("message differs after round trip")
+	}
+}
+
+func TestLoadGenericPackagerErrors(t *testing.T) {
+	bad := `<isopackager><isofield id="2" length="19" class="org.jpos.iso.IFX_UNKNOWN"/></isopackager>`
+	if _, err := LoadGenericPackager(strings.NewReader(bad)); err == nil {
+		t.Error("unknown class was accepted")
+	}
+}
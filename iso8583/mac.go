@@ -0,0 +1,135 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"bytes"
+	"crypto/des"
+	"crypto/subtle"
+	"errors"
+)
+
+// Reasons a MAC can fail
+var (
+	ErrBadMAC    = errors.New("MAC does not match")
+	ErrNoMAC     = errors.New("message has no MAC")
+	ErrMACKeyLen = errors.New("bad MAC key length")
+)
+
+// MACAlgorithm selects how the MAC is computed
+type MACAlgorithm int
+
+const (
+	// X99 is the ANSI X9.9 MAC: DES CBC with a single length key
+	X99 MACAlgorithm = iota
+	// X919 is the ANSI X9.19 retail MAC: DES CBC with the left half of a
+	// double length key and 3DES on the last block
+	X919
+)
+
+// MACKey computes and checks the MAC of messages
+type MACKey struct {
+	Alg MACAlgorithm
+	Key []byte // 8 bytes for X99, 16 bytes for X919
+}
+
+// Compute returns the 8 byte MAC of data, padded with zeros to full blocks
+func (k *MACKey) Compute(data []byte) ([]byte, error) {
+	size := 8
+	if k.Alg == X919 {
+		size = 16
+	}
+	if len(k.Key) != size {
+		return nil, ErrMACKeyLen
+	}
+	k1, err := des.NewCipher(k.Key[:8])
+	if err != nil {
+		return nil, err
+	}
+
+	mac := make([]byte, 8)
+	for i := 0; i < len(data) || i == 0; i += 8 {
+		block := make([]byte, 8)
+		copy(block, data[i:])
+		for j := range mac {
+			mac[j] ^= block[j]
+		}
+		k1.Encrypt(mac, mac)
+	}
+
+	if k.Alg == X919 {
+		k2, err := des.NewCipher(k.Key[8:])
+		if err != nil {
+			return nil, err
+		}
+		k2.Decrypt(mac, mac)
+		k1.Encrypt(mac, mac)
+	}
+	return mac, nil
+}
+
+// macField returns the MAC field of m, the last field of its last bitmap
+func (m *Iso8583Message) macField() uint {
+	tmp := Iso8583Message{Bitmap: m.Bitmap}
+	return uint(tmp.bitmapBlocks() * 64)
+}
+
+// SetMAC computes the MAC of m with key and stores it in field 64, 128
+// or 192, whichever ends the last bitmap of the message. The MAC covers
+// the serialized message up to the MAC field.
+func (m *Iso8583Message) SetMAC(spec *Spec, key *MACKey) error {
+	// the MAC bit is part of the MAC data
+	no := m.macField()
+	m.Set(no, string(make([]byte, 8)))
+	data, err := m.macData(spec, no)
+	if err != nil {
+		return err
+	}
+	mac, err := key.Compute(data)
+	if err != nil {
+		return err
+	}
+	m.Set(no, string(mac))
+	return nil
+}
+
+// VerifyMAC checks the MAC of m by serializing it again. Parse with
+// Spec.MAC set checks the bytes as received instead.
+func (m *Iso8583Message) VerifyMAC(spec *Spec, key *MACKey) error {
+	no := m.macField()
+	if !m.Bitmap[no-1] {
+		return &FieldError{no, 0, ErrNoMAC}
+	}
+	data, err := m.macData(spec, no)
+	if err != nil {
+		return err
+	}
+	return checkMAC(key, data, m.Get(no), no, int64(len(data)))
+}
+
+// macData serializes m up to the MAC field
+func (m *Iso8583Message) macData(spec *Spec, no uint) ([]byte, error) {
+	f := spec.Field(no)
+	if f == nil {
+		return nil, &FieldError{no, 0, ErrNoField}
+	}
+	var buf, mac bytes.Buffer
+	if err := m.Serialize(spec, &buf); err != nil {
+		return nil, err
+	}
+	if err := f.Write(&mac, m.Get(no)); err != nil {
+		return nil, &FieldError{no, 0, err}
+	}
+	return buf.Bytes()[:buf.Len()-mac.Len()], nil
+}
+
+func checkMAC(key *MACKey, data []byte, got string, no uint, offset int64) error {
+	want, err := key.Compute(data)
+	if err != nil {
+		return &FieldError{no, offset, err}
+	}
+	if subtle.ConstantTimeCompare(want, []byte(got)) != 1 {
+		return &FieldError{no, offset, ErrBadMAC}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package iso8583
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestComputeMAC(t *testing.T) {
+	data := []byte("Now is the time for all ")
+	tests := []struct {
+		alg  MACAlgorithm
+		key  string
+		want string
+	}{
+		{X99, "0123456789ABCDEF", "70A30640CC76DD8B"},
+		{X919, "0123456789ABCDEFFEDCBA9876543210", "A1C72E74EA3FA9B6"},
+	}
+	for _, tt := range tests {
+		key, _ := hex.DecodeString(tt.key)
+		mac, err := (&MACKey{tt.alg, key}).Compute(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%X", mac); got != tt.want {
+			t.Errorf("alg %d: got %s, want %s", tt.alg, got, tt.want)
+		}
+	}
+
+	if _, err := (&MACKey{X919, make([]byte, 8)}).Compute(data); err != ErrMACKeyLen {
+		t.Errorf("short key: %v", err)
+	}
+}
+
+func TestMessageMAC(t *testing.T) {
+	key, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	mk := &MACKey{X919, key}
+
+	tests := []struct {
+		name string
+		msg  func() *Iso8583Message
+		no   uint
+	}{
+		{"primary", func() *Iso8583Message {
+			m := sampleMessage()
+			m.Unset(Account1)
+			return m
+		}, 64},
+		{"secondary", sampleMessage, 128},
+	}
+
+	for _, tt := range tests {
+		spec := DefaultSpec()
+		msg := tt.msg()
+		if err := msg.SetMAC(spec, mk); err != nil {
+			t.Fatal(err)
+		}
+		if !msg.Bitmap[tt.no-1] || len(msg.Get(tt.no)) != 8 {
+			t.Errorf("%s: no MAC in field %d", tt.name, tt.no)
+		}
+		if err := msg.VerifyMAC(spec, mk); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+
+		var buf bytes.Buffer
+		if err := msg.Serialize(spec, &buf); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+
+		spec.MAC = mk
+		if err := new(Iso8583Message).Parse(spec, bytes.NewReader(data)); err != nil {
+			t.Errorf("%s: parse: %v", tt.name, err)
+		}
+
+		// flip one bit before the MAC
+		bad := append([]byte{}, data...)
+		bad[len(bad)-20] ^= 1
+		err := new(Iso8583Message).Parse(spec, bytes.NewReader(bad))
+		var fe *FieldError
+		if !errors.As(err, &fe) || fe.Field != tt.no || fe.Err != ErrBadMAC {
+			t.Errorf("%s: tampered message: %v", tt.name, err)
+		}
+	}
+
+	// messages without MAC are rejected
+	spec := DefaultSpec()
+	var buf bytes.Buffer
+	sampleMessage().Serialize(spec, &buf)
+	spec.MAC = mk
+	err := new(Iso8583Message).Parse(spec, &buf)
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Err != ErrNoMAC {
+		t.Errorf("got %v, want %v", err, ErrNoMAC)
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// std is the spec used by the package level Marshal and Unmarshal
+var std = DefaultSpec()
+
+// default time layouts by field number
+var timeLayouts = map[uint]string{
+	TrxDate:        "0102150405",
+	LocalTime:      "150405",
+	LocalDate:      "0102",
+	ExpireDate:     "0601",
+	SettleDate:     "0102",
+	ConversionDate: "0102",
+	17:             "0102",
+	73:             "060102",
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Marshal sets the fields of a new message from the struct v using
+// DefaultSpec. See Spec.Marshal.
+func Marshal(v interface{}) (*Iso8583Message, error) {
+	return std.Marshal(v)
+}
+
+// Unmarshal fills the struct pointed to by v from m using DefaultSpec.
+// See Spec.Unmarshal.
+func Unmarshal(m *Iso8583Message, v interface{}) error {
+	return std.Unmarshal(m, v)
+}
+
+// Marshal sets the fields of a new message from the exported fields of
+// the struct v that carry an iso8583 tag:
+//
+//	type Auth struct {
+//		MTI      string    `iso8583:"0"`
+//		Amount   int64     `iso8583:"4"`
+//		Sent     time.Time `iso8583:"7"`
+//		Terminal string    `iso8583:"41,omitempty"`
+//		PinBlock []byte    `iso8583:"52,omitempty"`
+//		Expiry   time.Time `iso8583:"14,layout=0601"`
+//	}
+//
+// Integers are zero padded to the length of fixed fields. Times use the
+// layout option or the usual layout of fields 7, 12-17 and 73. Fields
+// with the omitempty option are left unset when they hold a zero value.
+func (s *Spec) Marshal(v interface{}) (*Iso8583Message, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.New("iso8583: Marshal of non-struct")
+	}
+
+	m := new(Iso8583Message)
+	err := s.walk(rv, func(no uint, opt tagOptions, fv reflect.Value) error {
+		if opt.omitEmpty && fv.IsZero() {
+			return nil
+		}
+		value, err := s.format(no, opt, fv)
+		if err != nil {
+			return err
+		}
+		return s.Set(m, no, value)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Unmarshal fills the tagged fields of the struct pointed to by v from
+// the fields present in m
+func (s *Spec) Unmarshal(m *Iso8583Message, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("iso8583: Unmarshal needs a pointer to a struct")
+	}
+
+	return s.walk(rv.Elem(), func(no uint, opt tagOptions, fv reflect.Value) error {
+		if no != 0 && !m.Bitmap[no-1] {
+			return nil
+		}
+		return s.scan(no, opt, m.Get(no), fv)
+	})
+}
+
+type tagOptions struct {
+	omitEmpty bool
+	layout    string
+}
+
+// walk calls fn for every tagged field of the struct rv, embedded
+// structs included
+func (s *Spec) walk(rv reflect.Value, fn func(uint, tagOptions, reflect.Value) error) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag, ok := sf.Tag.Lookup("iso8583")
+		if !ok {
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				if err := s.walk(rv.Field(i), fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if tag == "-" || sf.PkgPath != "" {
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		no, err := strconv.ParseUint(parts[0], 10, 0)
+		if err != nil || no > MaxField || no == 1 || no == 65 {
+			return fmt.Errorf("iso8583: bad field number in tag of %s", sf.Name)
+		}
+		var opt tagOptions
+		for _, p := range parts[1:] {
+			switch {
+			case p == "omitempty":
+				opt.omitEmpty = true
+			case strings.HasPrefix(p, "layout="):
+				opt.layout = p[len("layout="):]
+			default:
+				return fmt.Errorf("iso8583: unknown option %q in tag of %s", p, sf.Name)
+			}
+		}
+
+		if err := fn(uint(no), opt, rv.Field(i)); err != nil {
+			return fmt.Errorf("iso8583: %s: %v", sf.Name, err)
+		}
+	}
+	return nil
+}
+
+// format converts a struct field to the field value of field no
+func (s *Spec) format(no uint, opt tagOptions, fv reflect.Value) (string, error) {
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := fv.Int()
+		if typ, _, _, _ := fieldInfo(s.Field(no)); n < 0 && typ == "n" {
+			return "", fmt.Errorf("negative value %d for numeric field %d", n, no)
+		}
+		return s.padNumber(no, strconv.FormatInt(n, 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return s.padNumber(no, strconv.FormatUint(fv.Uint(), 10)), nil
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(fv.Bytes()), nil
+		}
+	case reflect.Struct:
+		if fv.Type() == timeType {
+			layout, err := timeLayout(no, opt)
+			if err != nil {
+				return "", err
+			}
+			return fv.Interface().(time.Time).Format(layout), nil
+		}
+	}
+	return "", fmt.Errorf("unsupported type %s", fv.Type())
+}
+
+// scan converts the value of field no into a struct field
+func (s *Spec) scan(no uint, opt tagOptions, value string, fv reflect.Value) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(orDefault(value, "0"), 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(orDefault(value, "0"), 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+		return nil
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			fv.SetBytes([]byte(value))
+			return nil
+		}
+	case reflect.Struct:
+		if fv.Type() == timeType {
+			layout, err := timeLayout(no, opt)
+			if err != nil {
+				return err
+			}
+			t, err := time.Parse(layout, s.padNumber(no, value))
+			if err != nil {
+				return err
+			}
+			fv.Set(reflect.ValueOf(t))
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported type %s", fv.Type())
+}
+
+// padNumber zero pads value to the length of a fixed numeric field
+func (s *Spec) padNumber(no uint, value string) string {
+	f, ok := s.Field(no).(*Field)
+	if !ok || f.Type[0] != 'n' || f.PadRight || len(value) >= f.Length {
+		return value
+	}
+	return strings.Repeat("0", f.Length-len(value)) + value
+}
+
+func timeLayout(no uint, opt tagOptions) (string, error) {
+	if opt.layout != "" {
+		return opt.layout, nil
+	}
+	if layout, ok := timeLayouts[no]; ok {
+		return layout, nil
+	}
+	return "", errors.New("no time layout")
+}
@@ -0,0 +1,123 @@
+package iso8583
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+type authRequest struct {
+	MTI      string    `iso8583:"0"`
+	PAN      string    `iso8583:"2"`
+	ProcCode int       `iso8583:"3"`
+	Amount   int64     `iso8583:"4"`
+	Sent     time.Time `iso8583:"7"`
+	STAN     uint32    `iso8583:"11"`
+	Local    time.Time `iso8583:"12"`
+	Terminal string    `iso8583:"41,omitempty"`
+	Merchant string    `iso8583:"42,omitempty"`
+	PinBlock []byte    `iso8583:"52,omitempty"`
+	Note     string
+}
+
+func TestMarshal(t *testing.T) {
+	sent := time.Date(0, 12, 31, 23, 59, 1, 0, time.UTC)
+	req := authRequest{
+		MTI:      "0200",
+		PAN:      "4111111111111111",
+		ProcCode: 3000,
+		Amount:   1500,
+		Sent:     sent,
+		STAN:     42,
+		Local:    time.Date(0, 1, 1, 9, 5, 0, 0, time.UTC),
+		Terminal: "TERM0001",
+		PinBlock: []byte{0x12, 0x34},
+	}
+
+	m, err := Marshal(&req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint]string{0: "0200", 2: "4111111111111111", 3: "003000", 4: "000000001500",
+		7: "1231235901", 11: "000042", 12: "090500", 41: "TERM0001", 52: "\x12\x34"}
+	for no, v := range want {
+		if m.Get(no) != v {
+			t.Errorf("field %d = %q, want %q", no, m.Get(no), v)
+		}
+	}
+	if m.Bitmap[41] {
+		t.Error("empty field 42 was set")
+	}
+
+	// through the wire and back, numeric fields lose their zeros on the way
+	spec := DefaultSpec()
+	spec.SetField(52, &Field{Type: "b", Length: 2})
+	var buf bytes.Buffer
+	if err := m.Serialize(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	parsed := new(Iso8583Message)
+	if err := parsed.Parse(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var got authRequest
+	if err := spec.Unmarshal(parsed, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.MTI != req.MTI || got.PAN != req.PAN || got.ProcCode != req.ProcCode ||
+		got.Amount != req.Amount || got.STAN != req.STAN || got.Terminal != req.Terminal ||
+		!bytes.Equal(got.PinBlock, req.PinBlock) {
+		t.Errorf("got %+v", got)
+	}
+	if !got.Sent.Equal(sent) || got.Local.Hour() != 9 || got.Local.Minute() != 5 {
+		t.Errorf("got times %v, %v", got.Sent, got.Local)
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	if _, err := Marshal(42); err == nil {
+		t.Error("non-struct was accepted")
+	}
+	if _, err := Marshal(struct {
+		F float64 `iso8583:"4"`
+	}{1}); err == nil {
+		t.Error("float was accepted")
+	}
+	if _, err := Marshal(struct {
+		F string `iso8583:"x"`
+	}{}); err == nil {
+		t.Error("bad tag was accepted")
+	}
+	if _, err := Marshal(struct {
+		T time.Time `iso8583:"48"`
+	}{time.Now()}); err == nil {
+		t.Error("time without layout was accepted")
+	}
+
+	if _, err := Marshal(struct {
+		Amount int64 `iso8583:"4"`
+	}{-5}); err == nil {
+		t.Error("negative amount was accepted")
+	}
+
+	spec := DefaultSpec()
+	spec.Strict = true
+	if _, err := spec.Marshal(struct {
+		Amount string `iso8583:"4"`
+	}{"1.5"}); err == nil {
+		t.Error("strict spec accepted bad amount")
+	}
+
+	m := new(Iso8583Message)
+	m.Set(AMOUNT, "abc")
+	var v struct {
+		Amount int64 `iso8583:"4"`
+	}
+	if err := Unmarshal(m, v); err == nil {
+		t.Error("non-pointer was accepted")
+	}
+	if err := Unmarshal(m, &v); err == nil {
+		t.Error("bad number was accepted")
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrBadMTI is returned for a message type indicator that is not valid
+var ErrBadMTI = errors.New("bad message type indicator")
+
+// MTI is a message type indicator. Its four digits are the ISO 8583
+// version, message class, message function and message origin.
+type MTI string
+
+// MessageClass is the second digit of an MTI
+type MessageClass byte
+
+// Message classes
+const (
+	ClassAuthorization  MessageClass = '1'
+	ClassFinancial      MessageClass = '2'
+	ClassFileAction     MessageClass = '3'
+	ClassReversal       MessageClass = '4'
+	ClassReconciliation MessageClass = '5'
+	ClassAdministrative MessageClass = '6'
+	ClassFeeCollection  MessageClass = '7'
+	ClassNetwork        MessageClass = '8'
+)
+
+// MessageFunction is the third digit of an MTI
+type MessageFunction byte
+
+// Message functions
+const (
+	FunctionRequest         MessageFunction = '0'
+	FunctionRequestResponse MessageFunction = '1'
+	FunctionAdvice          MessageFunction = '2'
+	FunctionAdviceResponse  MessageFunction = '3'
+	FunctionNotification    MessageFunction = '4'
+	FunctionNotificationAck MessageFunction = '5'
+	FunctionInstruction     MessageFunction = '6'
+	FunctionInstructionAck  MessageFunction = '7'
+	FunctionResponseAck     MessageFunction = '8'
+	FunctionNegativeAck     MessageFunction = '9'
+)
+
+// MessageOrigin is the fourth digit of an MTI
+type MessageOrigin byte
+
+// Message origins, odd origins are repeats
+const (
+	OriginAcquirer       MessageOrigin = '0'
+	OriginAcquirerRepeat MessageOrigin = '1'
+	OriginIssuer         MessageOrigin = '2'
+	OriginIssuerRepeat   MessageOrigin = '3'
+	OriginOther          MessageOrigin = '4'
+	OriginOtherRepeat    MessageOrigin = '5'
+)
+
+var classNames = map[MessageClass]string{
+	ClassAuthorization:  "Authorization",
+	ClassFinancial:      "Financial",
+	ClassFileAction:     "File Action",
+	ClassReversal:       "Reversal/Chargeback",
+	ClassReconciliation: "Reconciliation",
+	ClassAdministrative: "Administrative",
+	ClassFeeCollection:  "Fee Collection",
+	ClassNetwork:        "Network Management",
+}
+
+var functionNames = map[MessageFunction]string{
+	FunctionRequest:         "Request",
+	FunctionRequestResponse: "Request Response",
+	FunctionAdvice:          "Advice",
+	FunctionAdviceResponse:  "Advice Response",
+	FunctionNotification:    "Notification",
+	FunctionNotificationAck: "Notification Acknowledgement",
+	FunctionInstruction:     "Instruction",
+	FunctionInstructionAck:  "Instruction Acknowledgement",
+	FunctionResponseAck:     "Response Acknowledgement",
+	FunctionNegativeAck:     "Negative Acknowledgement",
+}
+
+var originNames = map[MessageOrigin]string{
+	OriginAcquirer:       "Acquirer",
+	OriginAcquirerRepeat: "Acquirer Repeat",
+	OriginIssuer:         "Issuer",
+	OriginIssuerRepeat:   "Issuer Repeat",
+	OriginOther:          "Other",
+	OriginOtherRepeat:    "Other Repeat",
+}
+
+func (c MessageClass) String() string    { return digitName(byte(c), classNames[c]) }
+func (f MessageFunction) String() string { return digitName(byte(f), functionNames[f]) }
+func (o MessageOrigin) String() string   { return digitName(byte(o), originNames[o]) }
+
+func digitName(d byte, name string) string {
+	if name == "" {
+		return fmt.Sprintf("Reserved (%c)", d)
+	}
+	return name
+}
+
+// Validate checks that t has four digits with a known version, class,
+// function and origin
+func (t MTI) Validate() error {
+	if len(t) != 4 || !allDigits(string(t)) {
+		return ErrBadMTI
+	}
+	if t.Version() == 0 || classNames[t.Class()] == "" || originNames[t.Origin()] == "" {
+		return ErrBadMTI
+	}
+	return nil
+}
+
+// Version returns the ISO 8583 version: 1987, 1993, 2003, or 8 for
+// national and 9 for private use. It returns 0 for unknown versions.
+func (t MTI) Version() int {
+	if len(t) != 4 {
+		return 0
+	}
+	switch t[0] {
+	case '0':
+		return 1987
+	case '1':
+		return 1993
+	case '2':
+		return 2003
+	case '8':
+		return 8
+	case '9':
+		return 9
+	}
+	return 0
+}
+
+// Class returns the message class digit
+func (t MTI) Class() MessageClass {
+	return MessageClass(t.digit(1))
+}
+
+// Function returns the message function digit
+func (t MTI) Function() MessageFunction {
+	return MessageFunction(t.digit(2))
+}
+
+// Origin returns the message origin digit
+func (t MTI) Origin() MessageOrigin {
+	return MessageOrigin(t.digit(3))
+}
+
+// IsResponse reports whether t answers or acknowledges another message
+func (t MTI) IsResponse() bool {
+	return (t.Function()-'0')%2 == 1
+}
+
+// IsRepeat reports whether t is a repeated message
+func (t MTI) IsRepeat() bool {
+	return (t.Origin()-'0')%2 == 1
+}
+
+// Response returns the MTI answering t: 0200 -> 0210, 0201 -> 0210,
+// 0420 -> 0430, 0800 -> 0810
+func (t MTI) Response() (MTI, error) {
+	if t.Validate() != nil || t.IsResponse() {
+		return "", ErrBadMTI
+	}
+	b := []byte(t)
+	b[2]++
+	if t.IsRepeat() {
+		b[3]--
+	}
+	return MTI(b), nil
+}
+
+// Repeat returns the repeat of t: 0200 -> 0201, 0420 -> 0421
+func (t MTI) Repeat() (MTI, error) {
+	if t.Validate() != nil || t.IsResponse() {
+		return "", ErrBadMTI
+	}
+	if t.IsRepeat() {
+		return t, nil
+	}
+	b := []byte(t)
+	b[3]++
+	return MTI(b), nil
+}
+
+// String describes the MTI, like "0200 1987 Financial Request from Acquirer"
+func (t MTI) String() string {
+	if t.Validate() != nil {
+		return string(t)
+	}
+	return fmt.Sprintf("%s %d %s %s from %s", string(t), t.Version(), t.Class(), t.Function(), t.Origin())
+}
+
+func (t MTI) digit(i int) byte {
+	if len(t) != 4 {
+		return 0
+	}
+	return t[i]
+}
@@ -0,0 +1,57 @@
+package iso8583
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMTI(t *testing.T) {
+	mti := MTI("0200")
+	if mti.Version() != 1987 || mti.Class() != ClassFinancial || mti.Function() != FunctionRequest || mti.Origin() != OriginAcquirer {
+		t.Errorf("got %d %c %c %c", mti.Version(), mti.Class(), mti.Function(), mti.Origin())
+	}
+	if s := MTI("1420").String(); s != "1420 1993 Reversal/Chargeback Advice from Acquirer" {
+		t.Errorf("got %q", s)
+	}
+
+	responses := map[MTI]MTI{"0200": "0210", "0201": "0210", "0400": "0410", "0420": "0430", "0800": "0810", "1100": "1110", "0120": "0130"}
+	for req, want := range responses {
+		if got, err := req.Response(); err != nil || got != want {
+			t.Errorf("%s: response %s %v, want %s", req, got, err, want)
+		}
+	}
+	repeats := map[MTI]MTI{"0200": "0201", "0400": "0401", "0420": "0421", "0221": "0221"}
+	for req, want := range repeats {
+		if got, err := req.Repeat(); err != nil || got != want {
+			t.Errorf("%s: repeat %s %v, want %s", req, got, err, want)
+		}
+	}
+	for _, bad := range []MTI{"0210", "020", "02x0", "3200", "0206", "0900"} {
+		if _, err := bad.Response(); err != ErrBadMTI {
+			t.Errorf("%s: response accepted", bad)
+		}
+	}
+}
+
+func TestParseMTI(t *testing.T) {
+	spec := DefaultSpec()
+	data := []byte("0200\x00\x00\x00\x00\x00\x00\x00\x00")
+
+	if err := new(Iso8583Message).Parse(spec, bytes.NewReader(data)); err != nil {
+		t.Errorf("valid MTI rejected: %v", err)
+	}
+
+	spec.Version = 1993
+	err := new(Iso8583Message).Parse(spec, bytes.NewReader(data))
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Field != 0 || !errors.Is(err, ErrBadMTI) {
+		t.Errorf("got %v, want field 0: %v", err, ErrBadMTI)
+	}
+
+	spec.Version = 0
+	err = new(Iso8583Message).Parse(spec, bytes.NewReader([]byte("02A0\x00\x00\x00\x00\x00\x00\x00\x00")))
+	if !errors.As(err, &fe) || fe.Field != 0 || fe.Err != ErrBadMTI {
+		t.Errorf("got %v, want field 0: %v", err, ErrBadMTI)
+	}
+}
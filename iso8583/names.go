@@ -0,0 +1,127 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+// isoNames are the ISO 8583:1987 data element names
+var isoNames = [MaxField + 1]string{
+	0:   "Message Type Indicator",
+	1:   "Bitmap",
+	2:   "Primary Account Number",
+	3:   "Processing Code",
+	4:   "Amount, Transaction",
+	5:   "Amount, Settlement",
+	6:   "Amount, Cardholder Billing",
+	7:   "Transmission Date and Time",
+	8:   "Amount, Cardholder Billing Fee",
+	9:   "Conversion Rate, Settlement",
+	10:  "Conversion Rate, Cardholder Billing",
+	11:  "Systems Trace Audit Number",
+	12:  "Time, Local Transaction",
+	13:  "Date, Local Transaction",
+	14:  "Date, Expiration",
+	15:  "Date, Settlement",
+	16:  "Date, Conversion",
+	17:  "Date, Capture",
+	18:  "Merchant Type",
+	19:  "Acquiring Institution Country Code",
+	20:  "PAN Extended, Country Code",
+	21:  "Forwarding Institution Country Code",
+	22:  "POS Entry Mode",
+	23:  "Card Sequence Number",
+	24:  "Network International Identifier",
+	25:  "POS Condition Code",
+	26:  "POS PIN Capture Code",
+	27:  "Authorisation ID Response Length",
+	28:  "Amount, Transaction Fee",
+	29:  "Amount, Settlement Fee",
+	30:  "Amount, Transaction Processing Fee",
+	31:  "Amount, Settlement Processing Fee",
+	32:  "Acquiring Institution ID Code",
+	33:  "Forwarding Institution ID Code",
+	34:  "PAN Extended",
+	35:  "Track 2 Data",
+	36:  "Track 3 Data",
+	37:  "Retrieval Reference Number",
+	38:  "Authorisation ID Response",
+	39:  "Response Code",
+	40:  "Service Restriction Code",
+	41:  "Card Acceptor Terminal ID",
+	42:  "Card Acceptor ID Code",
+	43:  "Card Acceptor Name/Location",
+	44:  "Additional Response Data",
+	45:  "Track 1 Data",
+	46:  "Additional Data - ISO",
+	47:  "Additional Data - National",
+	48:  "Additional Data - Private",
+	49:  "Currency Code, Transaction",
+	50:  "Currency Code, Settlement",
+	51:  "Currency Code, Cardholder Billing",
+	52:  "PIN Data",
+	53:  "Security Related Control Information",
+	54:  "Additional Amounts",
+	55:  "ICC Data",
+	56:  "Message Reason Code",
+	57:  "Authorisation Life Cycle",
+	58:  "Authorising Agent Institution",
+	59:  "Reserved National",
+	60:  "Reserved National",
+	61:  "Reserved Private",
+	62:  "Reserved Private",
+	63:  "Reserved Private",
+	64:  "Message Authentication Code",
+	65:  "Bitmap, Extended",
+	66:  "Settlement Code",
+	67:  "Extended Payment Code",
+	68:  "Receiving Institution Country Code",
+	69:  "Settlement Institution Country Code",
+	70:  "Network Management Information Code",
+	71:  "Message Number",
+	72:  "Message Number, Last",
+	73:  "Date, Action",
+	74:  "Credits, Number",
+	75:  "Credits Reversal, Number",
+	76:  "Debits, Number",
+	77:  "Debits Reversal, Number",
+	78:  "Transfers, Number",
+	79:  "Transfers Reversal, Number",
+	80:  "Inquiries, Number",
+	81:  "Authorisations, Number",
+	82:  "Credits, Processing Fee Amount",
+	83:  "Credits, Transaction Fee Amount",
+	84:  "Debits, Processing Fee Amount",
+	85:  "Debits, Transaction Fee Amount",
+	86:  "Credits, Amount",
+	87:  "Credits Reversal, Amount",
+	88:  "Debits, Amount",
+	89:  "Debits Reversal, Amount",
+	90:  "Original Data Elements",
+	91:  "File Update Code",
+	92:  "File Security Code",
+	93:  "Response Indicator",
+	94:  "Service Indicator",
+	95:  "Replacement Amounts",
+	96:  "Message Security Code",
+	97:  "Amount, Net Settlement",
+	98:  "Payee",
+	99:  "Settlement Institution ID Code",
+	100: "Receiving Institution ID Code",
+	101: "File Name",
+	102: "Account Identification 1",
+	103: "Account Identification 2",
+	104: "Transaction Description",
+	118: "Payments, Number",
+	119: "Payments Reversal, Number",
+	128: "Message Authentication Code",
+}
+
+// FieldName returns the description of field no. Fields without a name in
+// the spec fall back to the ISO 8583:1987 name.
+func (s *Spec) FieldName(no uint) string {
+	if no > MaxField {
+		return ""
+	}
+	if s.Names[no] != "" {
+		return s.Names[no]
+	}
+	return isoNames[no]
+}
@@ -14,7 +14,7 @@ func (no *NullOut) Write(p []byte) (n int, err error) {
 
 func BenchmarkSerialize(b *testing.B) {
 	// init
-	InitFieldTypes()
+	spec := DefaultSpec()
 
 	buf := bufio.NewWriter(new(NullOut))
 	//buf:=bytes.NewBuffer(make([]byte, 1000000))
@@ -32,6 +32,6 @@ func BenchmarkSerialize(b *testing.B) {
 		msg.Set(39, "00")
 		msg.Set(48, "01000abcdefghijkl                    ")
 
-		msg.Serialize(buf)
+		msg.Serialize(spec, buf)
 	}
 }
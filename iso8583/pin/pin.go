@@ -0,0 +1,296 @@
+// Copyright 2015 ubs121
+
+// Package pin builds, encrypts and translates ISO 9564 PIN blocks, as
+// carried in ISO 8583 field 52
+package pin
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Reasons a PIN block can fail
+var (
+	ErrBadPIN    = errors.New("pin: PIN must be 4 to 12 digits")
+	ErrBadPAN    = errors.New("pin: bad PAN")
+	ErrBadFormat = errors.New("pin: unsupported PIN block format")
+	ErrBadBlock  = errors.New("pin: bad PIN block")
+	ErrBadKey    = errors.New("pin: bad key length")
+)
+
+// Format is an ISO 9564-1 PIN block format
+type Format int
+
+const (
+	ISO0 Format = 0 // PIN xor PAN, F filled
+	ISO1 Format = 1 // PIN with random fill, not bound to the PAN
+	ISO3 Format = 3 // PIN xor PAN, filled with random A-F
+	ISO4 Format = 4 // 16 byte AES block bound to the PAN
+)
+
+// Rand is the source of fill digits
+var Rand io.Reader = rand.Reader
+
+// Build returns the clear 8 byte PIN block of format 0, 1 or 3. Format 4
+// blocks exist only encrypted, see Encrypt.
+func Build(f Format, pin, pan string) ([]byte, error) {
+	if f == ISO4 {
+		return nil, ErrBadFormat
+	}
+	field, err := pinField(f, pin, 16)
+	if err != nil {
+		return nil, err
+	}
+	if f == ISO1 {
+		return hexBytes(field), nil
+	}
+	pf, err := panField(pan)
+	if err != nil {
+		return nil, err
+	}
+	return xor(hexBytes(field), hexBytes(pf)), nil
+}
+
+// Parse returns the PIN of a clear format 0, 1 or 3 block
+func Parse(f Format, block []byte, pan string) (string, error) {
+	if f == ISO4 {
+		return "", ErrBadFormat
+	}
+	if len(block) != 8 {
+		return "", ErrBadBlock
+	}
+	if f != ISO1 {
+		pf, err := panField(pan)
+		if err != nil {
+			return "", err
+		}
+		block = xor(block, hexBytes(pf))
+	}
+	return parsePINField(f, strings.ToUpper(hex.EncodeToString(block)))
+}
+
+// Encrypt builds the PIN block and encrypts it. Formats 0, 1 and 3 use a
+// double or triple length 3DES key, format 4 an AES key.
+func Encrypt(key []byte, f Format, pin, pan string) ([]byte, error) {
+	if f == ISO4 {
+		return encrypt4(key, pin, pan)
+	}
+	block, err := Build(f, pin, pan)
+	if err != nil {
+		return nil, err
+	}
+	c, err := tdes(key)
+	if err != nil {
+		return nil, err
+	}
+	c.Encrypt(block, block)
+	return block, nil
+}
+
+// Decrypt decrypts a PIN block and returns the PIN
+func Decrypt(key []byte, f Format, block []byte, pan string) (string, error) {
+	if f == ISO4 {
+		return decrypt4(key, block, pan)
+	}
+	if len(block) != 8 {
+		return "", ErrBadBlock
+	}
+	c, err := tdes(key)
+	if err != nil {
+		return "", err
+	}
+	clear := make([]byte, 8)
+	c.Decrypt(clear, block)
+	return Parse(f, clear, pan)
+}
+
+// Translate decrypts a PIN block under one zone key and format and
+// encrypts it under another
+func Translate(from []byte, ff Format, to []byte, tf Format, block []byte, pan string) ([]byte, error) {
+	p, err := Decrypt(from, ff, block, pan)
+	if err != nil {
+		return nil, err
+	}
+	return Encrypt(to, tf, p, pan)
+}
+
+// pinField returns the control nibble, the PIN length, the PIN and the
+// fill of format f as n hex digits
+func pinField(f Format, pin string, n int) (string, error) {
+	if len(pin) < 4 || len(pin) > 12 || !digits(pin) {
+		return "", ErrBadPIN
+	}
+	var sb strings.Builder
+	sb.WriteByte(byte('0' + f))
+	sb.WriteByte("0123456789ABC"[len(pin)])
+	sb.WriteString(pin)
+	fill := make([]byte, n-sb.Len())
+	if f == ISO1 || f == ISO3 {
+		if _, err := io.ReadFull(Rand, fill); err != nil {
+			return "", err
+		}
+	}
+	for _, b := range fill {
+		switch f {
+		case ISO0:
+			sb.WriteByte('F')
+		case ISO1:
+			sb.WriteByte("0123456789ABCDEF"[b&0xF])
+		case ISO3:
+			sb.WriteByte("ABCDEF"[int(b)%6])
+		case ISO4:
+			sb.WriteByte('A')
+		default:
+			return "", ErrBadFormat
+		}
+	}
+	return sb.String(), nil
+}
+
+// parsePINField checks the PIN field digits and returns the PIN
+func parsePINField(f Format, s string) (string, error) {
+	if s[0] != byte('0'+f) {
+		return "", ErrBadBlock
+	}
+	n := strings.IndexByte("0123456789ABC", s[1])
+	if n < 4 || 2+n > len(s) {
+		return "", ErrBadBlock
+	}
+	pin := s[2 : 2+n]
+	if !digits(pin) {
+		return "", ErrBadBlock
+	}
+	for _, c := range s[2+n:] {
+		ok := true
+		switch f {
+		case ISO0:
+			ok = c == 'F'
+		case ISO3:
+			ok = c >= 'A' && c <= 'F'
+		case ISO4:
+			ok = c == 'A'
+		}
+		if !ok {
+			return "", ErrBadBlock
+		}
+	}
+	return pin, nil
+}
+
+// panField returns the 16 digit PAN field of formats 0 and 3: four zeros
+// and the 12 rightmost PAN digits without the check digit
+func panField(pan string) (string, error) {
+	if len(pan) < 13 || len(pan) > 19 || !digits(pan) {
+		return "", ErrBadPAN
+	}
+	return "0000" + pan[len(pan)-13:len(pan)-1], nil
+}
+
+// panField4 returns the 32 digit PAN field of format 4: the PAN length
+// above 12, the PAN left padded to 12 digits, and zero fill
+func panField4(pan string) (string, error) {
+	if len(pan) < 1 || len(pan) > 19 || !digits(pan) {
+		return "", ErrBadPAN
+	}
+	m := 0
+	if len(pan) > 12 {
+		m = len(pan) - 12
+	} else {
+		pan = strings.Repeat("0", 12-len(pan)) + pan
+	}
+	s := string(rune('0'+m)) + pan
+	return s + strings.Repeat("0", 32-len(s)), nil
+}
+
+func encrypt4(key []byte, pin, pan string) ([]byte, error) {
+	c, err := aesCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	field, err := pinField(ISO4, pin, 16)
+	if err != nil {
+		return nil, err
+	}
+	// the second half of the plain text block is random
+	block := make([]byte, 16)
+	copy(block, hexBytes(field))
+	if _, err := io.ReadFull(Rand, block[8:]); err != nil {
+		return nil, err
+	}
+	pf, err := panField4(pan)
+	if err != nil {
+		return nil, err
+	}
+	c.Encrypt(block, block)
+	block = xor(block, hexBytes(pf))
+	c.Encrypt(block, block)
+	return block, nil
+}
+
+func decrypt4(key, block []byte, pan string) (string, error) {
+	if len(block) != 16 {
+		return "", ErrBadBlock
+	}
+	c, err := aesCipher(key)
+	if err != nil {
+		return "", err
+	}
+	pf, err := panField4(pan)
+	if err != nil {
+		return "", err
+	}
+	clear := make([]byte, 16)
+	c.Decrypt(clear, block)
+	clear = xor(clear, hexBytes(pf))
+	c.Decrypt(clear, clear)
+	return parsePINField(ISO4, strings.ToUpper(hex.EncodeToString(clear[:8])))
+}
+
+// tdes returns a 3DES cipher, double length keys are used as K1 K2 K1
+func tdes(key []byte) (cipher.Block, error) {
+	switch len(key) {
+	case 16:
+		k := make([]byte, 0, 24)
+		k = append(append(k, key...), key[:8]...)
+		return des.NewTripleDESCipher(k)
+	case 24:
+		return des.NewTripleDESCipher(key)
+	}
+	return nil, ErrBadKey
+}
+
+func aesCipher(key []byte) (cipher.Block, error) {
+	switch len(key) {
+	case 16, 24, 32:
+		return aes.NewCipher(key)
+	}
+	return nil, ErrBadKey
+}
+
+func hexBytes(s string) []byte {
+	b, _ := hex.DecodeString(s)
+	return b
+}
+
+func xor(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
+
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+package pin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"testing"
+)
+
+const pan = "4111111111111111"
+
+func TestBuild(t *testing.T) {
+	block, err := Build(ISO0, "1234", pan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%X", block); got != "041225EEEEEEEEEE" {
+		t.Errorf("format 0: got %s", got)
+	}
+
+	for _, f := range []Format{ISO0, ISO1, ISO3} {
+		for _, p := range []string{"1234", "123456789012"} {
+			block, err := Build(f, p, pan)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Parse(f, block, pan)
+			if err != nil || got != p {
+				t.Errorf("format %d: got %q, %v, want %q", f, got, err, p)
+			}
+		}
+	}
+	// format 3 fill is A-F after removing the PAN
+	pf, _ := panField(pan)
+	for i := 0; i < 10; i++ {
+		block, _ = Build(ISO3, "1234", pan)
+		field := fmt.Sprintf("%X", xor(block, hexBytes(pf)))
+		for _, c := range field[6:] {
+			if c < 'A' || c > 'F' {
+				t.Fatalf("format 3 fill of %s is not A-F", field)
+			}
+		}
+	}
+
+	errs := []struct {
+		f   Format
+		pin string
+		pan string
+		err error
+	}{
+		{ISO0, "123", pan, ErrBadPIN},
+		{ISO0, "1234567890123", pan, ErrBadPIN},
+		{ISO0, "12a4", pan, ErrBadPIN},
+		{ISO0, "1234", "411111", ErrBadPAN},
+		{ISO4, "1234", pan, ErrBadFormat},
+	}
+	for _, tt := range errs {
+		if _, err := Build(tt.f, tt.pin, tt.pan); err != tt.err {
+			t.Errorf("format %d %q %q: got %v, want %v", tt.f, tt.pin, tt.pan, err, tt.err)
+		}
+	}
+
+	// format 0 block under the wrong PAN
+	block, _ = Build(ISO0, "1234", pan)
+	if _, err := Parse(ISO0, block, "5500000000000004"); err != ErrBadBlock {
+		t.Errorf("wrong PAN: got %v", err)
+	}
+}
+
+func TestKnownAnswers(t *testing.T) {
+	defer func(r io.Reader) { Rand = r }(Rand)
+	fill := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	aesKey, _ := hex.DecodeString("00112233445566778899AABBCCDDEEFF")
+
+	tests := []struct {
+		f    Format
+		want string
+	}{
+		{ISO1, "1412340123456789"},
+		{ISO3, "341225BADCFEBADC"},
+	}
+	for _, tt := range tests {
+		Rand = bytes.NewReader(fill)
+		block, err := Build(tt.f, "1234", pan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%X", block); got != tt.want {
+			t.Errorf("format %d: got %s, want %s", tt.f, got, tt.want)
+		}
+	}
+
+	Rand = bytes.NewReader(fill[1:])
+	block, err := Encrypt(aesKey, ISO4, "1234", pan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%X", block); got != "0D832259FA45B34128B944D7D70AD8A3" {
+		t.Errorf("format 4: got %s", got)
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	tdesKey, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	aesKey, _ := hex.DecodeString("00112233445566778899AABBCCDDEEFF")
+
+	tests := []struct {
+		f    Format
+		key  []byte
+		size int
+	}{
+		{ISO0, tdesKey, 8},
+		{ISO1, tdesKey, 8},
+		{ISO3, tdesKey, 8},
+		{ISO4, aesKey, 16},
+	}
+	for _, tt := range tests {
+		block, err := Encrypt(tt.key, tt.f, "98765", pan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(block) != tt.size {
+			t.Errorf("format %d: block of %d bytes", tt.f, len(block))
+		}
+		got, err := Decrypt(tt.key, tt.f, block, pan)
+		if err != nil || got != "98765" {
+			t.Errorf("format %d: got %q, %v", tt.f, got, err)
+		}
+	}
+
+	// format 4 is bound to the PAN
+	block, _ := Encrypt(aesKey, ISO4, "98765", pan)
+	if _, err := Decrypt(aesKey, ISO4, block, "4111111111111112"); err != ErrBadBlock {
+		t.Errorf("wrong PAN: got %v", err)
+	}
+	if _, err := Encrypt(aesKey[:8], ISO0, "1234", pan); err != ErrBadKey {
+		t.Errorf("short key: got %v", err)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	zpk1, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	zpk2, _ := hex.DecodeString("FEDCBA98765432100123456789ABCDEF")
+	aesKey, _ := hex.DecodeString("00112233445566778899AABBCCDDEEFF")
+
+	block, err := Encrypt(zpk1, ISO0, "4321", pan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Translate(zpk1, ISO0, zpk2, ISO0, block, pan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(out, block) {
+		t.Error("block not translated")
+	}
+	if p, err := Decrypt(zpk2, ISO0, out, pan); err != nil || p != "4321" {
+		t.Errorf("got %q, %v", p, err)
+	}
+
+	out, err = Translate(zpk2, ISO0, aesKey, ISO4, out, pan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := Decrypt(aesKey, ISO4, out, pan); err != nil || p != "4321" {
+		t.Errorf("format 4: got %q, %v", p, err)
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Totals are the reconciliation totals of fields 74-89. Amounts are in
+// minor units of the settlement currency.
+type Totals struct {
+	Credits           int64 // field 74
+	CreditReversals   int64 // field 75
+	Debits            int64 // field 76
+	DebitReversals    int64 // field 77
+	Transfers         int64 // field 78
+	TransferReversals int64 // field 79
+	Inquiries         int64 // field 80
+	Authorizations    int64 // field 81
+
+	CreditProcessingFees  int64 // field 82
+	CreditTransactionFees int64 // field 83
+	DebitProcessingFees   int64 // field 84
+	DebitTransactionFees  int64 // field 85
+
+	CreditAmount         int64 // field 86
+	CreditReversalAmount int64 // field 87
+	DebitAmount          int64 // field 88
+	DebitReversalAmount  int64 // field 89
+}
+
+// field returns the total carried in field no, 74-89
+func (t *Totals) field(no uint) *int64 {
+	return [...]*int64{
+		&t.Credits, &t.CreditReversals, &t.Debits, &t.DebitReversals,
+		&t.Transfers, &t.TransferReversals, &t.Inquiries, &t.Authorizations,
+		&t.CreditProcessingFees, &t.CreditTransactionFees, &t.DebitProcessingFees, &t.DebitTransactionFees,
+		&t.CreditAmount, &t.CreditReversalAmount, &t.DebitAmount, &t.DebitReversalAmount,
+	}[no-74]
+}
+
+// Net returns the net settlement amount, credits less debits after
+// reversals
+func (t *Totals) Net() int64 {
+	return t.CreditAmount - t.CreditReversalAmount - t.DebitAmount + t.DebitReversalAmount
+}
+
+// Add counts one completed transaction: an approved response, or an
+// advice. Requests, repeats, advice responses and declined responses are
+// ignored. Messages are not matched to each other, so feed either the
+// responses or the advices of a transaction, never both: the 0220
+// completing an approved 0200 would be counted a second time.
+// Processing codes 00-19 are debits, 20-29 credits, 30-39 inquiries and
+// 40-49 transfers, the code is read with spec. A financial or reversal
+// message without a processing code is an error.
+func (t *Totals) Add(spec *Spec, m *Iso8583Message) error {
+	if err := m.Mti.Validate(); err != nil {
+		return err
+	}
+	if m.Mti.IsRepeat() {
+		// the original was counted, or will be when it is answered
+		return nil
+	}
+	fn := m.Mti.Function()
+	if fn != FunctionRequestResponse && fn != FunctionAdvice && fn != FunctionAdviceResponse {
+		return nil
+	}
+	if m.Bitmap[ResponseCode-1] && m.Get(ResponseCode) != "00" {
+		return nil
+	}
+
+	class := m.Mti.Class()
+	if class == ClassAuthorization {
+		t.Authorizations++
+		return nil
+	}
+	if class != ClassFinancial && class != ClassReversal {
+		return nil
+	}
+	// an advice and its response are the same transaction
+	if fn == FunctionAdviceResponse {
+		return nil
+	}
+	if !m.Bitmap[ProcCode-1] {
+		return fmt.Errorf("iso8583: %s has no processing code", m.Mti)
+	}
+	reversal := class == ClassReversal
+
+	amount, err := parseAmount(m.Get(AMOUNT))
+	if err != nil {
+		return err
+	}
+	if reversal && m.Bitmap[_095_REPLACEMENT_AMOUNTS-1] {
+		r, err := ParseReplacementAmounts(m.Get(_095_REPLACEMENT_AMOUNTS))
+		if err != nil {
+			return err
+		}
+		amount -= r.Transaction
+	}
+	var fees [2]int64
+	for i, no := range []uint{_030_TRAN_PROC_FEE_AMOUNT, TranFeeAmount} {
+		if m.Bitmap[no-1] {
+			f, err := parseFee(m.Get(no))
+			if err != nil {
+				return err
+			}
+			if f < 0 {
+				f = -f
+			}
+			fees[i] = f
+		}
+	}
+
+	code := spec.Value(m, ProcCode)
+	switch {
+	case code < "20":
+		t.count(reversal, &t.Debits, &t.DebitReversals)
+		t.sum(reversal, amount, &t.DebitAmount, &t.DebitReversalAmount)
+		t.DebitProcessingFees += fees[0]
+		t.DebitTransactionFees += fees[1]
+	case code < "30":
+		t.count(reversal, &t.Credits, &t.CreditReversals)
+		t.sum(reversal, amount, &t.CreditAmount, &t.CreditReversalAmount)
+		t.CreditProcessingFees += fees[0]
+		t.CreditTransactionFees += fees[1]
+	case code < "40":
+		t.Inquiries++
+	case code < "50":
+		t.count(reversal, &t.Transfers, &t.TransferReversals)
+	}
+	return nil
+}
+
+func (t *Totals) count(reversal bool, n, rev *int64) {
+	if reversal {
+		*rev++
+	} else {
+		*n++
+	}
+}
+
+func (t *Totals) sum(reversal bool, amount int64, n, rev *int64) {
+	if reversal {
+		*rev += amount
+	} else {
+		*n += amount
+	}
+}
+
+func parseAmount(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("iso8583: bad amount %q", s)
+	}
+	return n, nil
+}
+
+// Apply sets fields 74-89 and the net settlement amount (field 97) of m
+func (t *Totals) Apply(m *Iso8583Message) {
+	for no := uint(74); no <= 89; no++ {
+		m.Set(no, strconv.FormatInt(*t.field(no), 10))
+	}
+	net := t.Net()
+	sign := "C"
+	if net < 0 {
+		sign, net = "D", -net
+	}
+	m.Set(_097_AMOUNT_NET_SETTLEMENT, fmt.Sprintf("%s%016d", sign, net))
+}
+
+// TotalsOf reads fields 74-89 of m, like the totals of a counterparty's
+// 0510. Missing fields count as 0.
+func TotalsOf(m *Iso8583Message) (Totals, error) {
+	var t Totals
+	for no := uint(74); no <= 89; no++ {
+		n, err := parseAmount(m.Get(no))
+		if err != nil {
+			return t, &FieldError{no, 0, err}
+		}
+		*t.field(no) = n
+	}
+	return t, nil
+}
+
+// Difference is a total that does not match the counterparty's
+type Difference struct {
+	Field  uint
+	Name   string
+	Ours   int64
+	Theirs int64
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("field %d %s: ours %d, theirs %d", d.Field, d.Name, d.Ours, d.Theirs)
+}
+
+// Compare lists the totals that differ between ours and theirs, in field
+// order
+func Compare(spec *Spec, ours, theirs Totals) []Difference {
+	var diffs []Difference
+	for no := uint(74); no <= 89; no++ {
+		if a, b := *ours.field(no), *theirs.field(no); a != b {
+			diffs = append(diffs, Difference{no, spec.FieldName(no), a, b})
+		}
+	}
+	return diffs
+}
+
+// ReconKey identifies one set of totals: a settlement date (MMDD) and
+// an institution
+type ReconKey struct {
+	Date        string
+	Institution string
+}
+
+// Reconciler keeps totals per settlement date and acquiring institution
+type Reconciler struct {
+	spec   *Spec
+	mu     sync.Mutex
+	totals map[ReconKey]*Totals
+}
+
+// NewReconciler returns an empty reconciler for messages of spec
+func NewReconciler(spec *Spec) *Reconciler {
+	return &Reconciler{spec: spec, totals: make(map[ReconKey]*Totals)}
+}
+
+// KeyOf returns the totals m is counted in: the settlement date (field
+// 15, or the local date, field 13, or today) and the acquirer (field 32)
+func KeyOf(spec *Spec, m *Iso8583Message) ReconKey {
+	date := ""
+	switch {
+	case m.Bitmap[SettleDate-1]:
+		date = spec.Value(m, SettleDate)
+	case m.Bitmap[LocalDate-1]:
+		date = spec.Value(m, LocalDate)
+	default:
+		date = time.Now().Format("0102")
+	}
+	return ReconKey{date, m.Get(ACQUIRER)}
+}
+
+// Add counts m in the totals of its key, see Totals.Add for the messages
+// to feed
+func (r *Reconciler) Add(m *Iso8583Message) error {
+	key := KeyOf(r.spec, m)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.totals[key]
+	if t == nil {
+		t = new(Totals)
+	}
+	if err := t.Add(r.spec, m); err != nil {
+		return err
+	}
+	if *t != (Totals{}) {
+		r.totals[key] = t
+	}
+	return nil
+}
+
+// Keys returns the keys with totals, sorted by date and institution
+func (r *Reconciler) Keys() []ReconKey {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]ReconKey, 0, len(r.totals))
+	for k := range r.totals {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Date != keys[j].Date {
+			return keys[i].Date < keys[j].Date
+		}
+		return keys[i].Institution < keys[j].Institution
+	})
+	return keys
+}
+
+// Totals returns a copy of the totals of key
+func (r *Reconciler) Totals(key ReconKey) Totals {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t := r.totals[key]; t != nil {
+		return *t
+	}
+	return Totals{}
+}
+
+// Message builds the 0500 reconciliation request of key, or the 0520
+// advice if advice is set
+func (r *Reconciler) Message(key ReconKey, advice bool) *Iso8583Message {
+	m := new(Iso8583Message)
+	m.Mti = "0500"
+	if advice {
+		m.Mti = "0520"
+	}
+	m.Set(TrxDate, time.Now().UTC().Format("0102150405"))
+	m.Set(SettleDate, key.Date)
+	if key.Institution != "" {
+		m.Set(ACQUIRER, key.Institution)
+	}
+	t := r.Totals(key)
+	t.Apply(m)
+	return m
+}
+
+// Compare checks the 0510 response of the counterparty against our
+// totals of the same key. The response must carry at least one of the
+// fields 74-89.
+func (r *Reconciler) Compare(resp *Iso8583Message) ([]Difference, error) {
+	found := false
+	for no := uint(74); no <= 89 && !found; no++ {
+		found = resp.Bitmap[no-1]
+	}
+	if !found {
+		return nil, &FieldError{74, 0, ErrNoField}
+	}
+	theirs, err := TotalsOf(resp)
+	if err != nil {
+		return nil, err
+	}
+	return Compare(r.spec, r.Totals(KeyOf(r.spec, resp)), theirs), nil
+}
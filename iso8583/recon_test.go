@@ -0,0 +1,129 @@
+package iso8583
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// completed returns the approved response of a transaction
+func completed(mti MTI, code, amount string) *Iso8583Message {
+	req := new(Iso8583Message)
+	req.Mti = mti
+	req.Set(ProcCode, code)
+	req.Set(AMOUNT, amount)
+	req.Set(SettleDate, "1017")
+	req.Set(ACQUIRER, "12345")
+	resp, _ := NewResponse(req)
+	resp.Set(SettleDate, "1017")
+	resp.Set(ACQUIRER, "12345")
+	resp.Set(ResponseCode, "00")
+	return resp
+}
+
+func TestTotals(t *testing.T) {
+	spec := DefaultSpec()
+	r := NewReconciler(spec)
+
+	declined := completed("0200", "000000", "700")
+	declined.Set(ResponseCode, "51")
+	partial := completed("0400", "000000", "1000")
+	partial.Set(_095_REPLACEMENT_AMOUNTS, ReplacementAmounts{Transaction: 400}.String())
+	withFee := completed("0200", "010000", "2000")
+	withFee.Set(TranFeeAmount, "D00000150")
+	advice := completed("0200", "200000", "300")
+	advice.Mti = "0220"
+	advice.Unset(ResponseCode)
+	adviceAck := completed("0220", "200000", "300")
+	// repeats sent by a SAF queue are the same transactions
+	adviceRepeat, _ := NewRepeat(advice)
+	reversalRepeat := completed("0400", "000000", "1000")
+	reversalRepeat.Mti = "0421"
+
+	msgs := []*Iso8583Message{
+		completed("0200", "000000", "1000"),
+		withFee,
+		declined,
+		partial,
+		advice,
+		adviceRepeat,
+		adviceAck,
+		reversalRepeat,
+		completed("0200", "310000", "0"),
+		completed("0200", "400000", "500"),
+		completed("0100", "000000", "900"),
+		NewNetworkRequest(EchoTest),
+	}
+	for _, m := range msgs {
+		if err := r.Add(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// requests are not counted
+	req := completed("0200", "000000", "1000")
+	req.Mti = "0200"
+	r.Add(req)
+	// a financial message without a processing code is refused
+	noCode := completed("0200", "000000", "1000")
+	noCode.Unset(ProcCode)
+	if err := r.Add(noCode); err == nil {
+		t.Error("message without processing code was counted")
+	}
+
+	keys := r.Keys()
+	if len(keys) != 1 || keys[0] != (ReconKey{"1017", "12345"}) {
+		t.Fatalf("keys %v", keys)
+	}
+	got := r.Totals(keys[0])
+	want := Totals{
+		Debits: 2, DebitReversals: 1, Credits: 1, Inquiries: 1, Transfers: 1, Authorizations: 1,
+		DebitAmount: 3000, DebitReversalAmount: 600, CreditAmount: 300, DebitTransactionFees: 150,
+	}
+	if got != want {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+	if got.Net() != 300-3000+600 {
+		t.Errorf("net %d", got.Net())
+	}
+
+	// the 0500 goes over the wire, the counterparty disagrees on debits
+	var buf bytes.Buffer
+	if err := r.Message(keys[0], false).Serialize(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	msg := new(Iso8583Message)
+	if err := msg.Parse(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Mti != "0500" || msg.Get(_097_AMOUNT_NET_SETTLEMENT) != "D0000000000002100" {
+		t.Errorf("got %s with net %q", msg.Mti, msg.Get(_097_AMOUNT_NET_SETTLEMENT))
+	}
+	resp, _ := NewResponse(msg)
+	resp.Set(SettleDate, msg.Get(SettleDate))
+	resp.Set(ACQUIRER, msg.Get(ACQUIRER))
+	theirs, err := TotalsOf(msg)
+	if err != nil || theirs != got {
+		t.Fatalf("totals after parse %+v, %v", theirs, err)
+	}
+	theirs.Debits++
+	theirs.DebitAmount += 50
+	theirs.Apply(resp)
+
+	diffs, err := r.Compare(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 || diffs[0].Field != 76 || diffs[1].Field != 88 || diffs[1].Theirs != 3050 {
+		t.Errorf("differences %v", diffs)
+	}
+	if diffs[0].String() != "field 76 Debits, Number: ours 2, theirs 3" {
+		t.Errorf("got %q", diffs[0])
+	}
+
+	resp.Clear()
+	resp.Mti = "0510"
+	var fe *FieldError
+	if _, err := r.Compare(resp); !errors.As(err, &fe) || fe.Err != ErrNoField {
+		t.Errorf("response without totals: %v", err)
+	}
+}
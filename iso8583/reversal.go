@@ -0,0 +1,224 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrBadOriginalData is returned for malformed fields 90 and 95
+var ErrBadOriginalData = errors.New("iso8583: bad original data elements")
+
+// OriginalData is field 90, the key of the transaction a reversal or
+// advice refers to
+type OriginalData struct {
+	MTI              MTI
+	STAN             string // field 11 of the original
+	TransmissionDate string // field 7 of the original, MMDDhhmmss
+	Acquirer         string // field 32 of the original
+	Forwarder        string // field 33 of the original
+}
+
+// String formats the 42 digits of field 90
+func (o OriginalData) String() string {
+	return zeroPad(string(o.MTI), 4) + zeroPad(o.STAN, 6) + zeroPad(o.TransmissionDate, 10) +
+		zeroPad(o.Acquirer, 11) + zeroPad(o.Forwarder, 11)
+}
+
+// ParseOriginalData splits the 42 digits of field 90
+func ParseOriginalData(s string) (OriginalData, error) {
+	if len(s) != 42 || !allDigits(s) {
+		return OriginalData{}, ErrBadOriginalData
+	}
+	return OriginalData{
+		MTI:              MTI(s[:4]),
+		STAN:             s[4:10],
+		TransmissionDate: s[10:20],
+		Acquirer:         s[20:31],
+		Forwarder:        s[31:42],
+	}, nil
+}
+
+// OriginalData returns field 90 of m, read with spec
+func (m *Iso8583Message) OriginalData(spec *Spec) (OriginalData, error) {
+	if !m.Bitmap[_090_ORIGINAL_DATA_ELEMENTS-1] {
+		return OriginalData{}, ErrNoField
+	}
+	return ParseOriginalData(spec.Value(m, _090_ORIGINAL_DATA_ELEMENTS))
+}
+
+// ReplacementAmounts is field 95, the amounts actually dispensed or
+// approved in a partial reversal. Fees are debits when positive and
+// credits when negative.
+type ReplacementAmounts struct {
+	Transaction    int64
+	Settlement     int64
+	TransactionFee int64
+	SettlementFee  int64
+}
+
+// String formats the 42 characters of field 95
+func (r ReplacementAmounts) String() string {
+	return fmt.Sprintf("%012d%012d%s%s", r.Transaction, r.Settlement, fee(r.TransactionFee), fee(r.SettlementFee))
+}
+
+func fee(n int64) string {
+	if n < 0 {
+		return fmt.Sprintf("C%08d", -n)
+	}
+	return fmt.Sprintf("D%08d", n)
+}
+
+// ParseReplacementAmounts splits field 95
+func ParseReplacementAmounts(s string) (ReplacementAmounts, error) {
+	var r ReplacementAmounts
+	if len(s) != 42 {
+		return r, ErrBadOriginalData
+	}
+	var err error
+	if r.Transaction, err = strconv.ParseInt(s[:12], 10, 64); err != nil {
+		return r, ErrBadOriginalData
+	}
+	if r.Settlement, err = strconv.ParseInt(s[12:24], 10, 64); err != nil {
+		return r, ErrBadOriginalData
+	}
+	if r.TransactionFee, err = parseFee(s[24:33]); err != nil {
+		return r, err
+	}
+	r.SettlementFee, err = parseFee(s[33:42])
+	return r, err
+}
+
+func parseFee(s string) (int64, error) {
+	n, err := strconv.ParseInt(s[1:], 10, 64)
+	if err != nil || s[1] == '-' || s[1] == '+' {
+		return 0, ErrBadOriginalData
+	}
+	switch s[0] {
+	case 'C':
+		return -n, nil
+	case 'D':
+		return n, nil
+	}
+	return 0, ErrBadOriginalData
+}
+
+// copied from the original request into reversals and advices
+var reversalFields = []uint{
+	CardNo, ProcCode, AMOUNT, TraceNo, LocalTime, LocalDate, ExpireDate, MCC,
+	PosEntry, _023_CARD_SEQUENCE_NUM, PosType, ACQUIRER, FORWARDER, RefNo,
+	TERMINAL, BRANCH, DESC, CURRENCY,
+}
+
+// derive builds a message of class and function from req and its
+// optional response. The transmission date is set to now.
+func derive(req, resp *Iso8583Message, class MessageClass, function MessageFunction) (*Iso8583Message, error) {
+	if err := req.Mti.Validate(); err != nil {
+		return nil, err
+	}
+	if req.Mti.IsResponse() {
+		return nil, ErrBadMTI
+	}
+	origin := req.Mti.Origin()
+	if req.Mti.IsRepeat() {
+		origin--
+	}
+	m := new(Iso8583Message)
+	m.Mti = MTI([]byte{req.Mti[0], byte(class), byte(function), byte(origin)})
+	for _, no := range reversalFields {
+		if req.Bitmap[no-1] {
+			m.Set(no, req.Get(no))
+		}
+	}
+	if resp != nil {
+		for _, no := range []uint{ApprovalCode, ResponseCode} {
+			if resp.Bitmap[no-1] {
+				m.Set(no, resp.Get(no))
+			}
+		}
+	}
+	m.Set(TrxDate, time.Now().UTC().Format("0102150405"))
+	return m, nil
+}
+
+// NewReversal returns the 0400 reversal of req with field 90 pointing at
+// req. resp is the response to req, if any, its approval and response
+// codes are carried over.
+func NewReversal(req, resp *Iso8583Message) (*Iso8583Message, error) {
+	m, err := derive(req, resp, ClassReversal, FunctionRequest)
+	if err != nil {
+		return nil, err
+	}
+	m.Set(_090_ORIGINAL_DATA_ELEMENTS, originalData(req).String())
+	return m, nil
+}
+
+// NewReversalAdvice returns the 0420 reversal advice of req, as sent when
+// the response to req never arrived
+func NewReversalAdvice(req, resp *Iso8583Message) (*Iso8583Message, error) {
+	m, err := derive(req, resp, ClassReversal, FunctionAdvice)
+	if err != nil {
+		return nil, err
+	}
+	m.Set(_090_ORIGINAL_DATA_ELEMENTS, originalData(req).String())
+	return m, nil
+}
+
+// NewPartialReversal returns the reversal of req for an amount smaller
+// than the original one. Field 4 keeps the original amount and field 95
+// carries the amounts that stand.
+func NewPartialReversal(req, resp *Iso8583Message, actual ReplacementAmounts) (*Iso8583Message, error) {
+	m, err := NewReversal(req, resp)
+	if err != nil {
+		return nil, err
+	}
+	m.Set(_095_REPLACEMENT_AMOUNTS, actual.String())
+	return m, nil
+}
+
+// NewAdvice returns the advice of req in its own class, 0100 -> 0120 and
+// 0200 -> 0220, for transactions approved on behalf of the issuer
+func NewAdvice(req, resp *Iso8583Message) (*Iso8583Message, error) {
+	return derive(req, resp, req.Mti.Class(), FunctionAdvice)
+}
+
+// NewRepeat returns a copy of m with the repeat MTI, 0400 -> 0401
+func NewRepeat(m *Iso8583Message) (*Iso8583Message, error) {
+	mti, err := m.Mti.Repeat()
+	if err != nil {
+		return nil, err
+	}
+	r := *m
+	r.Mti = mti
+	if m.sub != nil {
+		r.sub = make(map[uint]map[string]string, len(m.sub))
+		for no, sub := range m.sub {
+			r.sub[no] = make(map[string]string, len(sub))
+			for k, v := range sub {
+				r.sub[no][k] = v
+			}
+		}
+	}
+	return &r, nil
+}
+
+func originalData(req *Iso8583Message) OriginalData {
+	return OriginalData{
+		MTI:              req.Mti,
+		STAN:             req.Get(TraceNo),
+		TransmissionDate: req.Get(TrxDate),
+		Acquirer:         req.Get(ACQUIRER),
+		Forwarder:        req.Get(FORWARDER),
+	}
+}
+
+func zeroPad(s string, n int) string {
+	if len(s) >= n {
+		return s
+	}
+	return strings.Repeat("0", n-len(s)) + s
+}
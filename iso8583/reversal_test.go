@@ -0,0 +1,150 @@
+package iso8583
+
+import (
+	"bytes"
+	"testing"
+)
+
+func originalRequest() *Iso8583Message {
+	req := sampleMessage()
+	req.Set(TrxDate, "1017093000")
+	req.Set(ACQUIRER, "12345")
+	req.Set(TERMINAL, "TERM0001")
+	return req
+}
+
+func TestOriginalData(t *testing.T) {
+	o := OriginalData{MTI: "0200", STAN: "123", TransmissionDate: "1017093000", Acquirer: "12345"}
+	s := o.String()
+	if s != "020000012310170930000000001234500000000000" {
+		t.Errorf("got %s", s)
+	}
+	got, err := ParseOriginalData(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := OriginalData{"0200", "000123", "1017093000", "00000012345", "00000000000"}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	for _, bad := range []string{"02x0", s[1:]} {
+		if _, err := ParseOriginalData(bad); err != ErrBadOriginalData {
+			t.Errorf("%s: got %v", bad, err)
+		}
+	}
+}
+
+func TestReplacementAmounts(t *testing.T) {
+	r := ReplacementAmounts{Transaction: 1000, Settlement: 1000, TransactionFee: 50, SettlementFee: -25}
+	s := r.String()
+	if s != "000000001000000000001000D00000050C00000025" {
+		t.Errorf("got %s", s)
+	}
+	got, err := ParseReplacementAmounts(s)
+	if err != nil || got != r {
+		t.Errorf("got %+v, %v", got, err)
+	}
+	if _, err := ParseReplacementAmounts("000000001000000000001000X00000050C00000025"); err != ErrBadOriginalData {
+		t.Errorf("bad fee sign: %v", err)
+	}
+}
+
+func TestReversal(t *testing.T) {
+	req := originalRequest()
+	resp, _ := NewResponse(req)
+	resp.Set(ApprovalCode, "A12345")
+	resp.Set(ResponseCode, "00")
+
+	tests := []struct {
+		name  string
+		build func() (*Iso8583Message, error)
+		mti   MTI
+		orig  bool
+	}{
+		{"reversal", func() (*Iso8583Message, error) { return NewReversal(req, resp) }, "0400", true},
+		{"timeout", func() (*Iso8583Message, error) { return NewReversalAdvice(req, nil) }, "0420", true},
+		{"advice", func() (*Iso8583Message, error) { return NewAdvice(req, resp) }, "0220", false},
+	}
+	for _, tt := range tests {
+		m, err := tt.build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Mti != tt.mti {
+			t.Errorf("%s: mti %s, want %s", tt.name, m.Mti, tt.mti)
+		}
+		for _, no := range []uint{CardNo, ProcCode, AMOUNT, TraceNo, ACQUIRER, RefNo, TERMINAL} {
+			if m.Get(no) != req.Get(no) {
+				t.Errorf("%s: field %d = %q, want %q", tt.name, no, m.Get(no), req.Get(no))
+			}
+		}
+		if len(m.Get(TrxDate)) != 10 {
+			t.Errorf("%s: transmission date %q", tt.name, m.Get(TrxDate))
+		}
+		if m.Bitmap[_090_ORIGINAL_DATA_ELEMENTS-1] != tt.orig {
+			t.Errorf("%s: field 90 present %v", tt.name, !tt.orig)
+		}
+		if tt.orig {
+			o, err := m.OriginalData(DefaultSpec())
+			if err != nil || o.MTI != "0200" || o.STAN != "000123" || o.TransmissionDate != "1017093000" {
+				t.Errorf("%s: field 90 %+v, %v", tt.name, o, err)
+			}
+		}
+	}
+
+	rev, _ := NewReversal(req, resp)
+	if rev.Get(ApprovalCode) != "A12345" {
+		t.Errorf("approval code %q", rev.Get(ApprovalCode))
+	}
+	if _, err := NewReversal(resp, nil); err != ErrBadMTI {
+		t.Errorf("reversal of a response: %v", err)
+	}
+
+	// on the wire and back
+	partial, err := NewPartialReversal(req, resp, ReplacementAmounts{Transaction: 1000, Settlement: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := DefaultSpec()
+	var buf bytes.Buffer
+	if err := partial.Serialize(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	got := new(Iso8583Message)
+	if err := got.Parse(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if o, err := got.OriginalData(spec); err != nil || o.MTI != "0200" {
+		t.Errorf("field 90 after parse: %+v, %v", o, err)
+	}
+	if r, err := ParseReplacementAmounts(got.Get(_095_REPLACEMENT_AMOUNTS)); err != nil || r.Transaction != 1000 {
+		t.Errorf("field 95 after parse: %+v, %v", r, err)
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	rev, _ := NewReversalAdvice(originalRequest(), nil)
+	rep, err := NewRepeat(rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Mti != "0421" || rev.Mti != "0420" {
+		t.Errorf("got %s from %s", rep.Mti, rev.Mti)
+	}
+	if rep.Get(_090_ORIGINAL_DATA_ELEMENTS) != rev.Get(_090_ORIGINAL_DATA_ELEMENTS) {
+		t.Error("repeat lost field 90")
+	}
+	rev.SetPath("48.AB", "1")
+	rep, _ = NewRepeat(rev)
+	rep.SetPath("48.AB", "2")
+	rep.SetPath("48.CD", "3")
+	if rev.GetPath("48.AB") != "1" || rev.GetPath("48.CD") != "" || rep.GetPath("48.AB") != "2" {
+		t.Errorf("subfields shared: original %q %q, repeat %q", rev.GetPath("48.AB"), rev.GetPath("48.CD"), rep.GetPath("48.AB"))
+	}
+	// a reversal of a repeated request points to the original class
+	req := originalRequest()
+	req.Mti = "0201"
+	if m, _ := NewReversal(req, nil); m.Mti != "0400" {
+		t.Errorf("got %s", m.Mti)
+	}
+}
@@ -0,0 +1,349 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNoRules is returned for messages whose MTI has no rules
+var ErrNoRules = errors.New("iso8583: no field rules for MTI")
+
+// Presence tells whether a field must be present in a message
+type Presence byte
+
+const (
+	Forbidden   Presence = 0   // field must not be present
+	Mandatory   Presence = 'M' // field must be present
+	Conditional Presence = 'C' // required under conditions the rules do not check
+	Optional    Presence = 'O' // field may be present
+)
+
+func (p Presence) String() string {
+	if p == Forbidden {
+		return "-"
+	}
+	return string(p)
+}
+
+// RuleError lists the fields of a message that break the rules
+type RuleError struct {
+	MTI       MTI
+	ProcCode  string
+	Missing   []uint // mandatory fields not present
+	Forbidden []uint // fields present that the rules do not allow
+}
+
+func (e *RuleError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		parts = append(parts, "missing fields "+joinFields(e.Missing))
+	}
+	if len(e.Forbidden) > 0 {
+		parts = append(parts, "forbidden fields "+joinFields(e.Forbidden))
+	}
+	return fmt.Sprintf("iso8583: %s %s: %s", string(e.MTI), e.ProcCode, strings.Join(parts, "; "))
+}
+
+func joinFields(nos []uint) string {
+	s := make([]string, len(nos))
+	for i, no := range nos {
+		s[i] = strconv.Itoa(int(no))
+	}
+	return strings.Join(s, ", ")
+}
+
+// RuleSet says which fields each kind of message carries. Rules are kept
+// per MTI and processing code prefix, the longest matching prefix wins
+// like in ServeMux. A prefixed rule starts as a copy of the rule of its
+// MTI without prefix.
+type RuleSet struct {
+	mu    sync.RWMutex
+	rules map[MTI][]*fieldRule
+}
+
+type fieldRule struct {
+	prefix string
+	fields [MaxField + 1]Presence
+}
+
+// NewRuleSet returns a rule set without rules
+func NewRuleSet() *RuleSet {
+	return &RuleSet{rules: make(map[MTI][]*fieldRule)}
+}
+
+// rule returns the rule of mti and prefix, creating it from the rule
+// without prefix if needed
+func (rs *RuleSet) rule(mti MTI, prefix string) *fieldRule {
+	var base *fieldRule
+	for _, r := range rs.rules[mti] {
+		if r.prefix == prefix {
+			return r
+		}
+		if r.prefix == "" {
+			base = r
+		}
+	}
+	r := &fieldRule{prefix: prefix}
+	if base != nil {
+		r.fields = base.fields
+	}
+	rs.rules[mti] = append(rs.rules[mti], r)
+	sort.Slice(rs.rules[mti], func(i, j int) bool {
+		return len(rs.rules[mti][i].prefix) > len(rs.rules[mti][j].prefix)
+	})
+	return r
+}
+
+// Set sets the presence of fields for mti and processing codes starting
+// with prefix, an empty prefix matches all
+func (rs *RuleSet) Set(mti MTI, prefix string, p Presence, fields ...uint) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	r := rs.rule(mti, prefix)
+	for _, no := range fields {
+		if no <= MaxField {
+			r.fields[no] = p
+		}
+	}
+}
+
+// Presence returns the rule of field no for mti and processing code
+func (rs *RuleSet) Presence(mti MTI, procCode string, no uint) Presence {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	if r := rs.match(mti, procCode); r != nil && no <= MaxField {
+		return r.fields[no]
+	}
+	return Forbidden
+}
+
+func (rs *RuleSet) match(mti MTI, procCode string) *fieldRule {
+	for _, r := range rs.rules[mti] {
+		if strings.HasPrefix(procCode, r.prefix) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Validate checks m against its rule and reports every missing and
+// forbidden field in a *RuleError. The processing code is read with
+// spec. The bitmap indicators, fields 1 and 65, are not checked.
+func (rs *RuleSet) Validate(spec *Spec, m *Iso8583Message) error {
+	code := spec.Value(m, ProcCode)
+
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	r := rs.match(m.Mti, code)
+	if r == nil {
+		return fmt.Errorf("%w %s", ErrNoRules, string(m.Mti))
+	}
+
+	e := &RuleError{MTI: m.Mti, ProcCode: code}
+	for no := uint(2); no <= MaxField; no++ {
+		if no == 65 {
+			continue
+		}
+		present := m.Bitmap[no-1]
+		switch {
+		case r.fields[no] == Mandatory && !present:
+			e.Missing = append(e.Missing, no)
+		case r.fields[no] == Forbidden && present:
+			e.Forbidden = append(e.Forbidden, no)
+		}
+	}
+	if len(e.Missing) > 0 || len(e.Forbidden) > 0 {
+		return e
+	}
+	return nil
+}
+
+// fieldList lists field numbers, n-m is a range
+func fieldList(list string) []uint {
+	var nos []uint
+	for _, s := range strings.Fields(list) {
+		lo, hi := s, s
+		if i := strings.IndexByte(s, '-'); i > 0 {
+			lo, hi = s[:i], s[i+1:]
+		}
+		a, _ := strconv.Atoi(lo)
+		b, _ := strconv.Atoi(hi)
+		for no := a; no <= b; no++ {
+			nos = append(nos, uint(no))
+		}
+	}
+	return nos
+}
+
+// defaultRules are the ISO 8583:1987 field rules of the common messages
+var defaultRules = []struct {
+	mtis    string
+	m, c, o string
+}{
+	{"0100 0200",
+		"3 4 7 11 12 13 22 25 41 49",
+		"2 14 15 18 23 26 28 30 32 33 35 36 37 42 45 52 53 54 55 64 128",
+		"43 48 60-63 102 103"},
+	{"0110 0210",
+		"3 4 7 11 39 41",
+		"2 12 13 15 32 33 37 38 49 54 55 64 128",
+		"44 48 60-63 102 103"},
+	{"0120 0220",
+		"3 4 7 11 12 13 22 25 41 49",
+		"2 14 15 18 23 26 28 30 32 33 35 36 37 38 39 42 45 54 55 64 128",
+		"43 48 60-63 102 103"},
+	{"0130 0230",
+		"3 4 7 11 39 41",
+		"2 15 32 33 37 49 64 128",
+		"44 48 60-63"},
+	{"0400 0420",
+		"3 4 7 11 41 49 90",
+		"2 12 13 14 15 18 22 23 25 28 30 32 33 37 38 39 42 56 64 95 128",
+		"43 48 60-63 102 103"},
+	{"0410 0430",
+		"3 4 7 11 39",
+		"2 15 32 33 37 41 49 64 90 95 128",
+		"44 48 60-63"},
+	{"0500 0520",
+		"7 11 15",
+		"32 50 64 66 74-89 97 99 128",
+		"48 60-63"},
+	{"0510 0530",
+		"7 11 15 39",
+		"32 50 64 66 74-89 97 99 128",
+		"48 60-63"},
+	{"0800",
+		"7 11 70",
+		"12 13 41 53 64 96 128",
+		"33 48 60-63 100"},
+	{"0810",
+		"7 11 39 70",
+		"12 13 41 53 64 96 128",
+		"33 44 48 60-63 100"},
+}
+
+// DefaultRules returns a new copy of the built-in ISO 8583:1987 rules
+// for the authorization, financial, reversal, reconciliation and network
+// management messages. Repeats (0201, 0421, ...) follow the rules of
+// their original MTI.
+func DefaultRules() *RuleSet {
+	rs := NewRuleSet()
+	for _, d := range defaultRules {
+		for _, mti := range strings.Fields(d.mtis) {
+			for _, t := range []MTI{MTI(mti), repeatOf(MTI(mti))} {
+				rs.Set(t, "", Mandatory, fieldList(d.m)...)
+				rs.Set(t, "", Conditional, fieldList(d.c)...)
+				rs.Set(t, "", Optional, fieldList(d.o)...)
+			}
+		}
+	}
+	return rs
+}
+
+func repeatOf(t MTI) MTI {
+	if r, err := t.Repeat(); err == nil {
+		return r
+	}
+	return t
+}
+
+// RulesVersion is the JSON rules format version understood by Load
+const RulesVersion = 1
+
+// JSON rules file layout, fields not listed keep their presence and "-"
+// forbids a field
+//
+//	{
+//	  "version": 1,
+//	  "rules": [
+//	    {"mti": "0200", "processingCode": "31", "fields": {"4": "O", "54": "M"}},
+//	    {"mti": "0800", "fields": {"48": "-"}}
+//	  ]
+//	}
+type jsonRules struct {
+	Version int        `json:"version"`
+	Rules   []jsonRule `json:"rules"`
+}
+
+type jsonRule struct {
+	MTI            MTI               `json:"mti"`
+	ProcessingCode string            `json:"processingCode"`
+	Fields         map[string]string `json:"fields"`
+}
+
+var rulePresence = map[string]Presence{
+	"M": Mandatory,
+	"C": Conditional,
+	"O": Optional,
+	"-": Forbidden,
+}
+
+// Load applies the overrides of a JSON rules file. Nothing is changed
+// if the file is invalid.
+func (rs *RuleSet) Load(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var jr jsonRules
+	if err := dec.Decode(&jr); err != nil {
+		return fmt.Errorf("iso8583: rules: %v", err)
+	}
+	if jr.Version != RulesVersion {
+		return fmt.Errorf("iso8583: rules: unsupported version %d", jr.Version)
+	}
+
+	type change struct {
+		no uint
+		p  Presence
+	}
+	changes := make([][]change, len(jr.Rules))
+	for i, r := range jr.Rules {
+		if err := r.MTI.Validate(); err != nil {
+			return fmt.Errorf("iso8583: rules: %q: %v", r.MTI, err)
+		}
+		if len(r.ProcessingCode) > 6 || !allDigits(r.ProcessingCode) {
+			return fmt.Errorf("iso8583: rules: %s: bad processing code %q", r.MTI, r.ProcessingCode)
+		}
+		for k, v := range r.Fields {
+			no, err := strconv.Atoi(k)
+			if err != nil || no < 2 || no > MaxField {
+				return fmt.Errorf("iso8583: rules: %s: bad field %q", r.MTI, k)
+			}
+			p, ok := rulePresence[v]
+			if !ok {
+				return fmt.Errorf("iso8583: rules: %s: field %d: bad presence %q", r.MTI, no, v)
+			}
+			changes[i] = append(changes[i], change{uint(no), p})
+		}
+	}
+
+	for i, r := range jr.Rules {
+		for _, c := range changes[i] {
+			rs.Set(r.MTI, r.ProcessingCode, c.p, c.no)
+		}
+		if len(changes[i]) == 0 {
+			// an empty rule still creates the prefix
+			rs.Set(r.MTI, r.ProcessingCode, Forbidden)
+		}
+	}
+	return nil
+}
+
+// LoadFile applies the overrides of a JSON rules file
+func (rs *RuleSet) LoadFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return rs.Load(f)
+}
@@ -0,0 +1,162 @@
+package iso8583
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// purchase returns a 0200 with all fields the 1987 rules require
+func purchase() *Iso8583Message {
+	m := originalRequest()
+	m.Set(LocalTime, "093000")
+	m.Set(LocalDate, "1017")
+	m.Set(PosEntry, "51")
+	m.Set(PosType, "0")
+	m.Set(CURRENCY, "840")
+	m.Unset(ResponseCode)
+	return m
+}
+
+func TestDefaultRules(t *testing.T) {
+	spec := DefaultSpec()
+	rs := DefaultRules()
+	req := purchase()
+	req.Set(ExpireDate, "2512")
+	req.Set(MCC, "5411")
+	req.Set(_023_CARD_SEQUENCE_NUM, "1")
+	if err := rs.Validate(spec, req); err != nil {
+		t.Fatal(err)
+	}
+
+	// the messages built by this package pass the rules
+	resp, _ := NewResponse(req)
+	resp.Set(ResponseCode, "00")
+	rev, _ := NewReversal(req, resp)
+	revAdvice, _ := NewReversalAdvice(req, resp)
+	advice, _ := NewAdvice(req, resp)
+	rep, _ := NewRepeat(revAdvice)
+	echo := NewNetworkRequest(EchoTest)
+	echo.Set(TraceNo, "1")
+	echo.Set(TERMINAL, "TERM0001")
+	echoResp, _ := NewResponse(echo)
+	echoResp.Set(ResponseCode, "00")
+	echoResp.Set(_070_NETWORK_MANAGEMENT_INFORMATION_CODE, EchoTest)
+	for _, m := range []*Iso8583Message{resp, rev, revAdvice, advice, rep, echo, echoResp} {
+		if err := rs.Validate(spec, m); err != nil {
+			t.Errorf("%s: %v", m.Mti, err)
+		}
+	}
+
+	bad := purchase()
+	bad.Unset(AMOUNT)
+	bad.Unset(TERMINAL)
+	bad.Set(ResponseCode, "00")
+	bad.Set(_090_ORIGINAL_DATA_ELEMENTS, "0")
+	err := rs.Validate(spec, bad)
+	var re *RuleError
+	if !errors.As(err, &re) {
+		t.Fatalf("got %v, want *RuleError", err)
+	}
+	if !reflect.DeepEqual(re.Missing, []uint{4, 41}) || !reflect.DeepEqual(re.Forbidden, []uint{39, 90}) {
+		t.Errorf("missing %v, forbidden %v", re.Missing, re.Forbidden)
+	}
+	if want := "iso8583: 0200 000001: missing fields 4, 41; forbidden fields 39, 90"; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+
+	unknown := purchase()
+	unknown.Mti = "0600"
+	if err := rs.Validate(spec, unknown); !errors.Is(err, ErrNoRules) {
+		t.Errorf("got %v, want %v", err, ErrNoRules)
+	}
+}
+
+const rulesSample = `{
+  "version": 1,
+  "rules": [
+    {"mti": "0200", "processingCode": "31", "fields": {"4": "O", "54": "M"}},
+    {"mti": "0200", "fields": {"48": "-", "121": "O"}}
+  ]
+}`
+
+func TestLoadRules(t *testing.T) {
+	spec := DefaultSpec()
+	rs := DefaultRules()
+	if err := rs.Load(strings.NewReader(rulesSample)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		code string
+		no   uint
+		want Presence
+	}{
+		{"000000", 4, Mandatory},
+		{"310000", 4, Optional},
+		{"310000", 54, Mandatory},
+		{"310000", 41, Mandatory},
+		{"000000", 48, Forbidden},
+		{"000000", 121, Optional},
+		// the prefixed rule was copied before the base changed
+		{"310000", 48, Optional},
+	}
+	for _, tt := range tests {
+		if got := rs.Presence("0200", tt.code, tt.no); got != tt.want {
+			t.Errorf("%s field %d: got %s, want %s", tt.code, tt.no, got, tt.want)
+		}
+	}
+
+	balance := purchase()
+	balance.Set(ProcCode, "310000")
+	balance.Unset(AMOUNT)
+	var re *RuleError
+	if err := rs.Validate(spec, balance); !errors.As(err, &re) || !reflect.DeepEqual(re.Missing, []uint{54}) {
+		t.Errorf("balance inquiry: %v", err)
+	}
+
+	bad := []string{
+		`{"version": 2, "rules": []}`,
+		`{"version": 1, "rules": [{"mti": "02", "fields": {}}]}`,
+		`{"version": 1, "rules": [{"mti": "0200", "processingCode": "3x"}]}`,
+		`{"version": 1, "rules": [{"mti": "0200", "fields": {"1": "M"}}]}`,
+		`{"version": 1, "rules": [{"mti": "0200", "fields": {"4": "X"}}]}`,
+		`{"version": 1, "rules": [{"mti": "0200", "field": {}}]}`,
+	}
+	for _, s := range bad {
+		if err := rs.Load(strings.NewReader(s)); err == nil {
+			t.Errorf("%s was accepted", s)
+		}
+	}
+	if rs.Presence("0200", "000000", 4) != Mandatory {
+		t.Error("invalid file changed the rules")
+	}
+}
+
+func TestStrictRules(t *testing.T) {
+	spec := DefaultSpec()
+	spec.SetField(ExpireDate, &Field{Type: "n", Length: 4})
+	spec.SetField(_023_CARD_SEQUENCE_NUM, &Field{Type: "n", Length: 3})
+	spec.Strict = true
+	spec.Rules = DefaultRules()
+
+	req := purchase()
+	req.Set(ExpireDate, "2512")
+	req.Set(MCC, "5411")
+	req.Set(_023_CARD_SEQUENCE_NUM, "1")
+	if err := req.Serialize(spec, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	rev, _ := NewReversal(req, nil)
+	if err := rev.Serialize(spec, io.Discard); err != nil {
+		t.Errorf("reversal: %v", err)
+	}
+	m := purchase()
+	m.Unset(TraceNo)
+	var re *RuleError
+	if err := m.Serialize(spec, io.Discard); !errors.As(err, &re) || re.Missing[0] != TraceNo {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sender delivers a request and returns its response, Client and
+// Session are senders
+type Sender interface {
+	Send(ctx context.Context, req *Iso8583Message) (*Iso8583Message, error)
+}
+
+// SAF is a store and forward queue for advices and reversals. Every
+// message is kept in its own file in the queue directory until the host
+// acknowledges it, so the queue survives restarts. Messages are sent in
+// order, the first attempt with the MTI they were queued with and all
+// later ones with the repeat MTI (0420 -> 0421). A message that can no
+// longer be parsed is moved aside to a .bad file in the queue directory
+// and reported through OnError, it is never deleted.
+type SAF struct {
+	Spec *Spec
+
+	// MAC signs the repeats again, as the MAC covers the MTI. Without it
+	// repeats carry the MAC of the queued message, so messages should be
+	// queued without one.
+	MAC *MACKey
+
+	Backoff    time.Duration // wait after the first failure, 1s by default
+	MaxBackoff time.Duration // longest wait between attempts, 5m by default
+	Timeout    time.Duration // for one attempt, 30s by default
+
+	// OnError is called for failed attempts and for messages moved aside
+	OnError func(err error)
+
+	dir    string
+	mu     sync.Mutex
+	items  []*safItem
+	seq    uint64
+	notify chan struct{}
+}
+
+// safItem is the file content of a queued message
+type safItem struct {
+	seq      uint64
+	Enqueued time.Time `json:"enqueued"`
+	Attempts int       `json:"attempts"`
+	Message  []byte    `json:"message"` // serialized with the queue spec
+}
+
+// OpenSAF opens the queue in dir, creating it if needed, and loads the
+// messages left from earlier runs
+func OpenSAF(dir string, spec *Spec) (*SAF, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	q := &SAF{Spec: spec, dir: dir, notify: make(chan struct{}, 1)}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*.saf"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), ".saf"), 10, 64)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		it := &safItem{seq: seq}
+		if err := json.Unmarshal(data, it); err != nil {
+			return nil, fmt.Errorf("iso8583: queue file %s: %v", name, err)
+		}
+		q.items = append(q.items, it)
+		if seq > q.seq {
+			q.seq = seq
+		}
+	}
+	sort.Slice(q.items, func(i, j int) bool { return q.items[i].seq < q.items[j].seq })
+	return q, nil
+}
+
+func (q *SAF) backoff(attempts int) time.Duration {
+	d, max := q.Backoff, q.MaxBackoff
+	if d <= 0 {
+		d = time.Second
+	}
+	if max <= 0 {
+		max = 5 * time.Minute
+	}
+	for i := 1; i < attempts && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+func (q *SAF) timeout() time.Duration {
+	if q.Timeout > 0 {
+		return q.Timeout
+	}
+	return 30 * time.Second
+}
+
+// Add queues m, it is on disk when Add returns. m must parse back with
+// the queue spec, including its MAC check.
+func (q *SAF) Add(m *Iso8583Message) error {
+	var buf bytes.Buffer
+	if err := m.Serialize(q.Spec, &buf); err != nil {
+		return err
+	}
+	if err := new(Iso8583Message).Parse(q.Spec, bytes.NewReader(buf.Bytes())); err != nil {
+		return fmt.Errorf("iso8583: message cannot be queued: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	it := &safItem{seq: q.seq, Enqueued: time.Now(), Message: buf.Bytes()}
+	if err := q.save(it); err != nil {
+		return err
+	}
+	q.items = append(q.items, it)
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Len returns the number of queued messages
+func (q *SAF) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// OldestAge returns how long the oldest message has been waiting, 0 for
+// an empty queue
+func (q *SAF) OldestAge() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return 0
+	}
+	return time.Since(q.items[0].Enqueued)
+}
+
+// Run forwards queued messages with s until ctx is done
+func (q *SAF) Run(ctx context.Context, s Sender) error {
+	for {
+		q.mu.Lock()
+		var it *safItem
+		if len(q.items) > 0 {
+			it = q.items[0]
+		}
+		q.mu.Unlock()
+
+		if it == nil {
+			select {
+			case <-q.notify:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		err := q.forward(ctx, s, it)
+		if err == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if q.OnError != nil {
+			q.OnError(err)
+		}
+		select {
+		case <-time.After(q.backoff(it.Attempts)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// forward makes one attempt to deliver it
+func (q *SAF) forward(ctx context.Context, s Sender, it *safItem) error {
+	m := new(Iso8583Message)
+	if err := m.Parse(q.Spec, bytes.NewReader(it.Message)); err != nil {
+		// it will never parse, keep it out of the way of the others
+		if merr := q.moveAside(it); merr != nil {
+			return merr
+		}
+		if q.OnError != nil {
+			q.OnError(fmt.Errorf("iso8583: queued message %d moved to %s: %w", it.seq, q.badPath(it), err))
+		}
+		return nil
+	}
+	if it.Attempts > 0 {
+		r, err := NewRepeat(m)
+		if err != nil {
+			return err
+		}
+		m = r
+		if q.MAC != nil {
+			if err := m.SetMAC(q.Spec, q.MAC); err != nil {
+				return err
+			}
+		}
+	}
+
+	q.mu.Lock()
+	it.Attempts++
+	err := q.save(it)
+	q.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, q.timeout())
+	defer cancel()
+	if _, err := s.Send(ctx, m); err != nil {
+		return err
+	}
+	return q.remove(it)
+}
+
+func (q *SAF) remove(it *safItem) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.drop(it)
+	return os.Remove(q.path(it))
+}
+
+// moveAside takes it off the queue and keeps its file as a .bad file
+func (q *SAF) moveAside(it *safItem) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := os.Rename(q.path(it), q.badPath(it)); err != nil {
+		return err
+	}
+	q.drop(it)
+	return nil
+}
+
+// drop takes it off the queue, q.mu is held
+func (q *SAF) drop(it *safItem) {
+	for i := range q.items {
+		if q.items[i] == it {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			break
+		}
+	}
+}
+
+func (q *SAF) path(it *safItem) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d.saf", it.seq))
+}
+
+func (q *SAF) badPath(it *safItem) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d.bad", it.seq))
+}
+
+// save writes it to a temporary file first, so a crash leaves either the
+// old or the new content
+func (q *SAF) save(it *safItem) error {
+	data, err := json.Marshal(it)
+	if err != nil {
+		return err
+	}
+	tmp := q.path(it) + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path(it))
+}
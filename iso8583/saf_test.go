@@ -0,0 +1,207 @@
+package iso8583
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakySender fails the first n requests and records the MTIs it sees
+type flakySender struct {
+	mu    sync.Mutex
+	fail  int
+	mtis  []MTI
+	acked chan struct{}
+}
+
+func (s *flakySender) Send(ctx context.Context, req *Iso8583Message) (*Iso8583Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mtis = append(s.mtis, req.Mti)
+	if len(s.mtis) <= s.fail {
+		return nil, context.DeadlineExceeded
+	}
+	s.acked <- struct{}{}
+	return NewResponse(req)
+}
+
+func TestSAF(t *testing.T) {
+	dir := t.TempDir()
+	spec := DefaultSpec()
+
+	q, err := OpenSAF(dir, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev, _ := NewReversalAdvice(originalRequest(), nil)
+	adv, _ := NewAdvice(originalRequest(), nil)
+	for _, m := range []*Iso8583Message{rev, adv} {
+		if err := q.Add(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the messages survive a restart
+	q, err = OpenSAF(dir, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 2 || q.OldestAge() <= 0 {
+		t.Fatalf("reopened queue has %d messages, oldest %v", q.Len(), q.OldestAge())
+	}
+
+	q.Backoff = time.Millisecond
+	var failures int
+	q.OnError = func(err error) { failures++ }
+	s := &flakySender{fail: 2, acked: make(chan struct{}, 2)}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- q.Run(ctx, s) }()
+	<-s.acked
+	<-s.acked
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run returned %v", err)
+	}
+
+	want := []MTI{"0420", "0421", "0421", "0220"}
+	if len(s.mtis) != len(want) {
+		t.Fatalf("sent %v, want %v", s.mtis, want)
+	}
+	for i := range want {
+		if s.mtis[i] != want[i] {
+			t.Errorf("attempt %d: %s, want %s", i, s.mtis[i], want[i])
+		}
+	}
+	if failures != 2 {
+		t.Errorf("%d failures reported", failures)
+	}
+	if q.Len() != 0 || q.OldestAge() != 0 {
+		t.Errorf("%d messages left", q.Len())
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%d files left", len(files))
+	}
+}
+
+// macSender checks the MAC of every attempt before passing it on
+type macSender struct {
+	*flakySender
+	spec *Spec
+	key  *MACKey
+	errs chan error
+}
+
+func (s *macSender) Send(ctx context.Context, req *Iso8583Message) (*Iso8583Message, error) {
+	if err := req.VerifyMAC(s.spec, s.key); err != nil {
+		s.errs <- err
+	}
+	return s.flakySender.Send(ctx, req)
+}
+
+func TestSAFMAC(t *testing.T) {
+	spec := DefaultSpec()
+	key, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	mk := &MACKey{X919, key}
+
+	q, err := OpenSAF(t.TempDir(), spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.MAC = mk
+	q.Backoff = time.Millisecond
+	rev, _ := NewReversalAdvice(originalRequest(), nil)
+	if err := rev.SetMAC(spec, mk); err != nil {
+		t.Fatal(err)
+	}
+	q.Add(rev)
+
+	s := &macSender{&flakySender{fail: 1, acked: make(chan struct{}, 1)}, spec, mk, make(chan error, 2)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx, s)
+	<-s.acked
+	if len(s.mtis) != 2 || s.mtis[1] != "0421" {
+		t.Errorf("sent %v", s.mtis)
+	}
+	select {
+	case err := <-s.errs:
+		t.Errorf("bad MAC sent: %v", err)
+	default:
+	}
+}
+
+func TestSAFBadMessage(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+	macSpec := DefaultSpec()
+	macSpec.MAC = &MACKey{X919, key}
+
+	// refused up front when the queue spec cannot read it back
+	strict, err := OpenSAF(dir, macSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev, _ := NewReversalAdvice(originalRequest(), nil)
+	if err := strict.Add(rev); err == nil {
+		t.Error("message without MAC was queued")
+	}
+
+	// queued under another spec, it is kept as a .bad file
+	q, _ := OpenSAF(dir, DefaultSpec())
+	if err := q.Add(rev); err != nil {
+		t.Fatal(err)
+	}
+	q, _ = OpenSAF(dir, macSpec)
+	errs := make(chan error, 1)
+	q.OnError = func(err error) { errs <- err }
+	s := &flakySender{acked: make(chan struct{}, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx, s)
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrNoMAC) {
+			t.Errorf("got %v, want %v", err, ErrNoMAC)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("bad message was not reported")
+	}
+	if q.Len() != 0 {
+		t.Errorf("%d messages left", q.Len())
+	}
+	s.mu.Lock()
+	if len(s.mtis) != 0 {
+		t.Errorf("sent %v", s.mtis)
+	}
+	s.mu.Unlock()
+	bad, _ := filepath.Glob(filepath.Join(dir, "*.bad"))
+	if len(bad) != 1 {
+		t.Errorf("%d .bad files, want 1", len(bad))
+	}
+}
+
+func TestSAFBackoff(t *testing.T) {
+	q := &SAF{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempts, want := range []time.Duration{time.Second, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if got := q.backoff(attempts); got != want {
+			t.Errorf("attempt %d: %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestSAFBadFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "00000000000000000001.saf"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenSAF(dir, DefaultSpec()); err == nil {
+		t.Error("corrupt queue file was accepted")
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrServerClosed is returned by Serve after Close
+var ErrServerClosed = errors.New("iso8583: server closed")
+
+// echoFields are copied from a request into its response
+var echoFields = []uint{CardNo, ProcCode, AMOUNT, TrxDate, TraceNo, RefNo, TERMINAL}
+
+// NewResponse builds the response skeleton of req: the response MTI and
+// the fields 2, 3, 4, 7, 11, 37 and 41 of the request
+func NewResponse(req *Iso8583Message) (*Iso8583Message, error) {
+	mti, err := req.Mti.Response()
+	if err != nil {
+		return nil, err
+	}
+	resp := new(Iso8583Message)
+	resp.Mti = mti
+	for _, no := range echoFields {
+		if req.Bitmap[no-1] {
+			resp.Set(no, req.Get(no))
+		}
+	}
+	return resp, nil
+}
+
+// Handler answers a request. resp starts as the skeleton built by
+// NewResponse, a handler clearing resp.Mti sends no response.
+type Handler interface {
+	ServeISO8583(resp, req *Iso8583Message)
+}
+
+// HandlerFunc adapts a function to Handler
+type HandlerFunc func(resp, req *Iso8583Message)
+
+func (f HandlerFunc) ServeISO8583(resp, req *Iso8583Message) {
+	f(resp, req)
+}
+
+// ServeMux routes requests by MTI and processing code (field 3). A route
+// with a processing code prefix wins over one without, longer prefixes
+// win over shorter ones.
+type ServeMux struct {
+	// Spec gives the length of the processing code, DefaultSpec if nil
+	Spec *Spec
+
+	mu     sync.RWMutex
+	routes map[MTI][]route
+	// NotFound answers requests without a route, by default with
+	// response code 12 (invalid transaction)
+	NotFound Handler
+}
+
+type route struct {
+	prefix string
+	h      Handler
+}
+
+// NewServeMux returns an empty router
+func NewServeMux() *ServeMux {
+	return &ServeMux{routes: make(map[MTI][]route)}
+}
+
+// Handle registers h for mti and processing codes starting with prefix,
+// an empty prefix matches all
+func (mux *ServeMux) Handle(mti MTI, prefix string, h Handler) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	rs := mux.routes[mti]
+	for i := range rs {
+		if rs[i].prefix == prefix {
+			rs[i].h = h
+			return
+		}
+	}
+	rs = append(rs, route{prefix, h})
+	sort.Slice(rs, func(i, j int) bool { return len(rs[i].prefix) > len(rs[j].prefix) })
+	mux.routes[mti] = rs
+}
+
+// HandleFunc registers a function for mti and prefix
+func (mux *ServeMux) HandleFunc(mti MTI, prefix string, f func(resp, req *Iso8583Message)) {
+	mux.Handle(mti, prefix, HandlerFunc(f))
+}
+
+// Handler returns the handler for req
+func (mux *ServeMux) Handler(req *Iso8583Message) Handler {
+	spec := mux.Spec
+	if spec == nil {
+		spec = std
+	}
+	code := spec.Value(req, ProcCode)
+
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+	for _, r := range mux.routes[req.Mti] {
+		if strings.HasPrefix(code, r.prefix) {
+			return r.h
+		}
+	}
+	if mux.NotFound != nil {
+		return mux.NotFound
+	}
+	return HandlerFunc(invalidTransaction)
+}
+
+func (mux *ServeMux) ServeISO8583(resp, req *Iso8583Message) {
+	mux.Handler(req).ServeISO8583(resp, req)
+}
+
+func invalidTransaction(resp, req *Iso8583Message) {
+	resp.Set(ResponseCode, "12")
+}
+
+// Server answers framed requests on any number of connections. Requests
+// on one connection are handled concurrently, responses go out in the
+// order they are ready.
+type Server struct {
+	Spec    *Spec
+	Framer  Framer
+	Handler Handler
+
+	// OnError is called for connection and parse failures
+	OnError func(err error)
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewServer returns a server dispatching to h
+func NewServer(spec *Spec, framer Framer, h Handler) *Server {
+	return &Server{Spec: spec, Framer: framer, Handler: h}
+}
+
+// ListenAndServe listens on the TCP address addr and serves it
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until it fails or the server is closed
+func (s *Server) Serve(l net.Listener) error {
+	if !s.track(l, nil) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.untrack(l, nil)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn answers requests on conn until the peer disconnects
+func (s *Server) ServeConn(conn net.Conn) {
+	if !s.track(nil, conn) {
+		conn.Close()
+		return
+	}
+	defer s.untrack(nil, conn)
+	defer conn.Close()
+
+	var wmu sync.Mutex
+	var reqs sync.WaitGroup
+	defer reqs.Wait()
+	for {
+		req, f, err := ReadMessage(conn, s.Framer, s.Spec)
+		if err != nil {
+			if isMessageError(err) {
+				s.error(err)
+				continue
+			}
+			if err != io.EOF && !s.isClosed() {
+				s.error(err)
+			}
+			return
+		}
+
+		reqs.Add(1)
+		go func() {
+			defer reqs.Done()
+			resp := s.serve(req)
+			if resp == nil {
+				return
+			}
+			wmu.Lock()
+			defer wmu.Unlock()
+			if err := WriteMessage(conn, s.Framer, s.Spec, resp, replyHeader(f.Header)); err != nil {
+				s.error(err)
+			}
+		}()
+	}
+}
+
+// serve runs the handler, it returns nil when there is nothing to send
+func (s *Server) serve(req *Iso8583Message) *Iso8583Message {
+	resp, err := NewResponse(req)
+	if err != nil {
+		// a response or a bad MTI, nothing to answer
+		return nil
+	}
+	h := s.Handler
+	if h == nil {
+		h = HandlerFunc(invalidTransaction)
+	}
+	h.ServeISO8583(resp, req)
+	if resp.Mti == "" {
+		return nil
+	}
+	return resp
+}
+
+// replyHeader swaps the addresses of a TPDU header, other headers are
+// sent back unchanged
+func replyHeader(h []byte) []byte {
+	if t, err := ParseTPDU(h); err == nil {
+		return t.Reply().Bytes()
+	}
+	return h
+}
+
+func (s *Server) error(err error) {
+	if s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+func (s *Server) track(l net.Listener, c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+		s.conns = make(map[net.Conn]struct{})
+	}
+	if l != nil {
+		s.listeners[l] = struct{}{}
+	}
+	if c != nil {
+		s.conns[c] = struct{}{}
+	}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(l net.Listener, c net.Conn) {
+	s.mu.Lock()
+	delete(s.listeners, l)
+	delete(s.conns, c)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// Close stops all listeners and connections and waits for the handlers
+// in progress
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if e := l.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
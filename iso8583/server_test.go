@@ -0,0 +1,148 @@
+package iso8583
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewResponse(t *testing.T) {
+	req := sampleMessage()
+	req.Set(TrxDate, "1017120000")
+	req.Set(TERMINAL, "TERM0001")
+	resp, err := NewResponse(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Mti != "0210" {
+		t.Errorf("mti %s", resp.Mti)
+	}
+	for _, no := range []uint{CardNo, ProcCode, AMOUNT, TrxDate, TraceNo, RefNo, TERMINAL} {
+		if resp.Get(no) != req.Get(no) {
+			t.Errorf("field %d: got %q, want %q", no, resp.Get(no), req.Get(no))
+		}
+	}
+	if resp.Bitmap[ResponseCode-1] || resp.Bitmap[Account1-1] {
+		t.Error("response carries fields that are not echoed")
+	}
+	if _, err := NewResponse(resp); err == nil {
+		t.Error("response to a response")
+	}
+}
+
+func TestServeMux(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("0200", "", func(resp, req *Iso8583Message) { resp.Set(ResponseCode, "any") })
+	mux.HandleFunc("0200", "31", func(resp, req *Iso8583Message) { resp.Set(ResponseCode, "31") })
+	mux.HandleFunc("0200", "3100", func(resp, req *Iso8583Message) { resp.Set(ResponseCode, "3100") })
+
+	tests := []struct {
+		mti  MTI
+		code string
+		want string
+	}{
+		{"0200", "1", "any"},
+		{"0200", "310000", "3100"},
+		{"0200", "312000", "31"},
+		{"0100", "0", "12"},
+	}
+	for _, tt := range tests {
+		req := new(Iso8583Message)
+		req.Mti = tt.mti
+		req.Set(ProcCode, tt.code)
+		resp := new(Iso8583Message)
+		mux.ServeISO8583(resp, req)
+		if got := resp.Get(ResponseCode); got != tt.want {
+			t.Errorf("%s %s: got %q, want %q", tt.mti, tt.code, got, tt.want)
+		}
+	}
+
+	// a dialect with a 4 digit processing code
+	spec := DefaultSpec()
+	spec.SetField(ProcCode, &Field{Type: "n", Length: 4})
+	short := NewServeMux()
+	short.Spec = spec
+	short.HandleFunc("0200", "03", func(resp, req *Iso8583Message) { resp.Set(ResponseCode, "03") })
+	req := new(Iso8583Message)
+	req.Mti = "0200"
+	req.Set(ProcCode, "310")
+	resp := new(Iso8583Message)
+	short.ServeISO8583(resp, req)
+	if got := resp.Get(ResponseCode); got != "03" {
+		t.Errorf("4 digit code: got %q, want %q", got, "03")
+	}
+}
+
+func TestServerLoopback(t *testing.T) {
+	spec := DefaultSpec()
+	framer := NewTPDUFramer()
+
+	mux := NewServeMux()
+	mux.HandleFunc("0200", "00", func(resp, req *Iso8583Message) {
+		resp.Set(ResponseCode, "00")
+		resp.Set(ApprovalCode, "A"+req.Get(TraceNo))
+	})
+	mux.HandleFunc("0200", "31", func(resp, req *Iso8583Message) {
+		resp.Set(ResponseCode, "00")
+		resp.Set(AdditionalAmount, "1001840C000000012345")
+	})
+	// advices are acknowledged by the caller itself
+	mux.HandleFunc("0220", "", func(resp, req *Iso8583Message) { resp.Mti = "" })
+
+	srv := NewServer(spec, framer, mux)
+	srv.OnError = func(err error) { t.Error(err) }
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(l) }()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := NewClient(conn, spec, framer)
+		c.Header = TPDU{ID: 0x60, Destination: 1, Source: uint16(i)}.Bytes()
+		defer c.Close()
+
+		for j := 0; j < 10; j++ {
+			wg.Add(1)
+			go func(term string, code string) {
+				defer wg.Done()
+				req := new(Iso8583Message)
+				req.Mti = "0200"
+				req.Set(ProcCode, code)
+				req.Set(AMOUNT, "1000")
+				req.Set(TERMINAL, term)
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				resp, err := c.Send(ctx, req)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if resp.Mti != "0210" || resp.Get(ResponseCode) != "00" || resp.Get(TERMINAL) != term {
+					t.Errorf("%s %s: got %s %s from %s", term, code, resp.Mti, resp.Get(ResponseCode), resp.Get(TERMINAL))
+				}
+				if code == "310000" && resp.Get(AdditionalAmount) == "" {
+					t.Errorf("%s: balance missing", term)
+				}
+			}(fmt.Sprintf("T%d", i), []string{"000000", "310000"}[j%2])
+		}
+	}
+	wg.Wait()
+
+	if err := srv.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := <-served; err != ErrServerClosed {
+		t.Errorf("Serve returned %v", err)
+	}
+}
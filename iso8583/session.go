@@ -0,0 +1,247 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Network management information codes (field 70)
+const (
+	SignOn    = "001"
+	SignOff   = "002"
+	KeyChange = "161"
+	EchoTest  = "301"
+)
+
+// ErrNotConnected is returned when a session has no signed on connection
+var ErrNotConnected = errors.New("iso8583: not signed on")
+
+// NewNetworkRequest returns a 0800 request with the transmission date
+// and the network management code
+func NewNetworkRequest(code string) *Iso8583Message {
+	m := new(Iso8583Message)
+	m.Mti = "0800"
+	m.Set(TrxDate, time.Now().UTC().Format("0102150405"))
+	m.Set(_070_NETWORK_MANAGEMENT_INFORMATION_CODE, code)
+	return m
+}
+
+// Session keeps a signed on connection to a host. It signs on after
+// connecting, sends echo tests while idle, reconnects when the connection
+// drops or too many echo tests fail, and answers 0800 requests of the
+// host with 0810.
+type Session struct {
+	Spec   *Spec
+	Framer Framer
+	Header []byte
+
+	// Dial opens a new connection to the host
+	Dial func(ctx context.Context) (io.ReadWriteCloser, error)
+
+	EchoInterval    time.Duration // between echo tests, 60s by default
+	MaxEchoFailures int           // echo tests failing in a row before reconnecting, 3 by default
+	Timeout         time.Duration // for network management requests, 30s by default
+	ReconnectDelay  time.Duration // between connection attempts, 5s by default
+
+	// Handler answers requests of the host other than 0800
+	Handler Handler
+	// OnKeyChange is called for a 0800 key change of the host, an error
+	// declines it with response code 96
+	OnKeyChange func(req *Iso8583Message) error
+	// OnUp and OnDown are called when the session is signed on and
+	// when the connection is gone
+	OnUp   func()
+	OnDown func(err error)
+	// OnError is called for failures that do not end the session
+	OnError func(err error)
+
+	mu     sync.Mutex
+	client *Client
+}
+
+func (s *Session) echoInterval() time.Duration {
+	if s.EchoInterval > 0 {
+		return s.EchoInterval
+	}
+	return time.Minute
+}
+
+func (s *Session) maxEchoFailures() int {
+	if s.MaxEchoFailures > 0 {
+		return s.MaxEchoFailures
+	}
+	return 3
+}
+
+func (s *Session) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return 30 * time.Second
+}
+
+func (s *Session) reconnectDelay() time.Duration {
+	if s.ReconnectDelay > 0 {
+		return s.ReconnectDelay
+	}
+	return 5 * time.Second
+}
+
+// Run connects and keeps the session up until ctx is done, then it signs
+// off and returns ctx.Err()
+func (s *Session) Run(ctx context.Context) error {
+	for {
+		err := s.connect(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if s.OnDown != nil {
+			s.OnDown(err)
+		}
+		select {
+		case <-time.After(s.reconnectDelay()):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// connect runs one connection until it is lost
+func (s *Session) connect(ctx context.Context) error {
+	conn, err := s.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	c := NewClient(conn, s.Spec, s.Framer)
+	c.Header = s.Header
+	c.OnUnmatched = func(m *Iso8583Message) {
+		if !m.Mti.IsResponse() {
+			// answered off the read loop, the write may wait for the peer
+			go s.answer(c, m)
+		}
+	}
+	c.OnError = s.OnError
+	c.Start()
+	defer c.Close()
+
+	if err := s.network(ctx, c, SignOn); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.client = c
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.client = nil
+		s.mu.Unlock()
+	}()
+	if s.OnUp != nil {
+		s.OnUp()
+	}
+
+	failures := 0
+	ticker := time.NewTicker(s.echoInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.client = nil
+			s.mu.Unlock()
+			sctx, cancel := context.WithTimeout(context.Background(), s.timeout())
+			s.network(sctx, c, SignOff)
+			cancel()
+			return ctx.Err()
+		case <-c.Done():
+			return c.Err()
+		case <-ticker.C:
+			if err := s.network(ctx, c, EchoTest); err != nil {
+				failures++
+				if failures >= s.maxEchoFailures() {
+					return fmt.Errorf("iso8583: %d echo tests failed: %w", failures, err)
+				}
+				if s.OnError != nil {
+					s.OnError(err)
+				}
+				continue
+			}
+			failures = 0
+		}
+	}
+}
+
+// network sends a 0800 with code and checks the response code
+func (s *Session) network(ctx context.Context, c *Client, code string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout())
+	defer cancel()
+	resp, err := c.Send(ctx, NewNetworkRequest(code))
+	if err != nil {
+		return err
+	}
+	if rc := resp.Get(ResponseCode); rc != "00" {
+		return fmt.Errorf("iso8583: network management %s declined with %q", code, rc)
+	}
+	return nil
+}
+
+// answer responds to a request of the host
+func (s *Session) answer(c *Client, req *Iso8583Message) {
+	resp, err := NewResponse(req)
+	if err != nil {
+		return
+	}
+	if req.Mti == "0800" {
+		code := s.Spec.Value(req, _070_NETWORK_MANAGEMENT_INFORMATION_CODE)
+		resp.Set(_070_NETWORK_MANAGEMENT_INFORMATION_CODE, code)
+		resp.Set(ResponseCode, "00")
+		if code == KeyChange && s.OnKeyChange != nil {
+			if err := s.OnKeyChange(req); err != nil {
+				resp.Set(ResponseCode, "96")
+				if s.OnError != nil {
+					s.OnError(err)
+				}
+			}
+		}
+	} else if s.Handler != nil {
+		s.Handler.ServeISO8583(resp, req)
+	} else {
+		invalidTransaction(resp, req)
+	}
+	if resp.Mti == "" {
+		return
+	}
+	if err := c.Write(resp); err != nil && s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+// Client returns the signed on client, or nil
+func (s *Session) Client() *Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client
+}
+
+// Send sends req over the signed on connection
+func (s *Session) Send(ctx context.Context, req *Iso8583Message) (*Iso8583Message, error) {
+	c := s.Client()
+	if c == nil {
+		return nil, ErrNotConnected
+	}
+	return c.Send(ctx, req)
+}
+
+// ChangeKey asks the host for a key change
+func (s *Session) ChangeKey(ctx context.Context) error {
+	c := s.Client()
+	if c == nil {
+		return ErrNotConnected
+	}
+	return s.network(ctx, c, KeyChange)
+}
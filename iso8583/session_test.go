@@ -0,0 +1,184 @@
+package iso8583
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// networkHost answers 0800 requests and reports their codes, echo tests
+// are ignored when mute is set
+func networkHost(conn net.Conn, spec *Spec, framer Framer, mute bool, codes chan<- string) *Client {
+	host := NewClient(conn, spec, framer)
+	host.OnUnmatched = func(req *Iso8583Message) {
+		code := spec.Value(req, _070_NETWORK_MANAGEMENT_INFORMATION_CODE)
+		codes <- code
+		if mute && code == EchoTest {
+			return
+		}
+		resp, err := NewResponse(req)
+		if err != nil {
+			return
+		}
+		resp.Set(ResponseCode, "00")
+		go host.Write(resp)
+	}
+	host.Start()
+	return host
+}
+
+func TestSession(t *testing.T) {
+	spec := DefaultSpec()
+	framer := NewBinaryFramer()
+	codes := make(chan string, 100)
+	hosts := make(chan *Client, 1)
+	up := make(chan bool, 1)
+
+	s := &Session{
+		Spec:   spec,
+		Framer: framer,
+		Dial: func(ctx context.Context) (io.ReadWriteCloser, error) {
+			local, remote := net.Pipe()
+			hosts <- networkHost(remote, spec, framer, false, codes)
+			return local, nil
+		},
+		EchoInterval: 10 * time.Millisecond,
+		OnUp:         func() { up <- true },
+		OnKeyChange:  func(req *Iso8583Message) error { return errors.New("no key") },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	<-up
+	host := <-hosts
+	defer host.Close()
+	if code := <-codes; code != SignOn {
+		t.Fatalf("first request %s, want sign on", code)
+	}
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != EchoTest {
+			t.Fatalf("got %s, want echo test", code)
+		}
+	}
+
+	// requests of the host
+	tests := []struct {
+		code string
+		rc   string
+	}{
+		{EchoTest, "00"},
+		{KeyChange, "96"},
+	}
+	for _, tt := range tests {
+		resp, err := host.Send(context.Background(), NewNetworkRequest(tt.code))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Mti != "0810" || resp.Get(ResponseCode) != tt.rc || spec.Value(resp, _070_NETWORK_MANAGEMENT_INFORMATION_CODE) != tt.code {
+			t.Errorf("%s: got %s %s for %s", tt.code, resp.Mti, resp.Get(ResponseCode), spec.Value(resp, _070_NETWORK_MANAGEMENT_INFORMATION_CODE))
+		}
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run returned %v", err)
+	}
+	for code := range codes {
+		if code == SignOff {
+			break
+		}
+	}
+	if _, err := s.Send(context.Background(), sampleMessage()); err != ErrNotConnected {
+		t.Errorf("send after stop: %v", err)
+	}
+}
+
+func TestSessionReconnect(t *testing.T) {
+	spec := DefaultSpec()
+	framer := NewBinaryFramer()
+	codes := make(chan string, 100)
+	up := make(chan bool, 2)
+	down := make(chan error, 2)
+	dials := 0
+
+	s := &Session{
+		Spec:   spec,
+		Framer: framer,
+		Dial: func(ctx context.Context) (io.ReadWriteCloser, error) {
+			dials++
+			local, remote := net.Pipe()
+			// the first host stops answering echo tests
+			networkHost(remote, spec, framer, dials == 1, codes)
+			return local, nil
+		},
+		EchoInterval:    5 * time.Millisecond,
+		MaxEchoFailures: 2,
+		Timeout:         20 * time.Millisecond,
+		ReconnectDelay:  time.Millisecond,
+		OnUp:            func() { up <- true },
+		OnDown:          func(err error) { down <- err },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	<-up
+	if err := <-down; err == nil {
+		t.Error("connection dropped without a reason")
+	}
+	select {
+	case <-up:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no sign on after reconnect")
+	}
+}
+
+func TestSessionHostFirst(t *testing.T) {
+	spec := DefaultSpec()
+	framer := NewBinaryFramer()
+	answered := make(chan *Iso8583Message, 1)
+
+	s := &Session{
+		Spec:   spec,
+		Framer: framer,
+		Dial: func(ctx context.Context) (io.ReadWriteCloser, error) {
+			local, remote := net.Pipe()
+			go func() {
+				// the host speaks before the sign on
+				echo := NewNetworkRequest(EchoTest)
+				echo.Set(TraceNo, "77")
+				WriteMessage(remote, framer, spec, echo, nil)
+				for {
+					m, _, err := ReadMessage(remote, framer, spec)
+					if err != nil {
+						return
+					}
+					if m.Mti.IsResponse() {
+						answered <- m
+						continue
+					}
+					resp, _ := NewResponse(m)
+					resp.Set(ResponseCode, "00")
+					go WriteMessage(remote, framer, spec, resp, nil)
+				}
+			}()
+			return local, nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	select {
+	case m := <-answered:
+		if m.Mti != "0810" || m.Get(TraceNo) != "77" || m.Get(ResponseCode) != "00" {
+			t.Errorf("got %s %s %s", m.Mti, m.Get(TraceNo), m.Get(ResponseCode))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("first echo test of the host was not answered")
+	}
+}
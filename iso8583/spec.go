@@ -0,0 +1,74 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import "fmt"
+
+// MaxField is the highest field number a message can carry
+const MaxField = 192
+
+// Spec is a packager for one ISO 8583 dialect. It owns the field table
+// used by Parse and Serialize, so several dialects can live in one process.
+type Spec struct {
+	Name   string
+	MtiEnc Encoder // MTI encoding, ASCII if nil
+	Bitmap BitmapEncoding
+	Fields [MaxField + 1]IField // indexed by field number
+	Names  [MaxField + 1]string // field descriptions, indexed by field number
+
+	// Version restricts the MTIs accepted by Parse to one ISO 8583
+	// version (1987, 1993 or 2003), any version is accepted if 0
+	Version int
+
+	// Strict rejects values that do not match their field type or are
+	// too long. Otherwise long fixed values are truncated as they are
+	// written.
+	Strict bool
+
+	// MAC makes Parse check the MAC in the last field of the last
+	// bitmap, messages without one are rejected
+	MAC *MACKey
+
+	// Rules are checked by Serialize in strict mode, before the field
+	// values
+	Rules *RuleSet
+}
+
+// NewSpec creates an empty spec
+func NewSpec(name string) *Spec {
+	return &Spec{Name: name}
+}
+
+// Field returns the definition of field no, or nil if it is not defined
+func (s *Spec) Field(no uint) IField {
+	if no > MaxField {
+		return nil
+	}
+	return s.Fields[no]
+}
+
+// Value returns field no of m as carried on the wire. Parse strips the
+// leading zeros of fixed length numeric fields, Value puts them back up
+// to the length the spec gives the field. Absent fields are empty.
+func (s *Spec) Value(m *Iso8583Message, no uint) string {
+	if no == 0 || no > MaxField || !m.Bitmap[no-1] {
+		return ""
+	}
+	return s.padNumber(no, m.Get(no))
+}
+
+// SetField defines field no
+func (s *Spec) SetField(no uint, f IField) {
+	s.Fields[no] = f
+}
+
+// ValidateMTI checks t and its version against the spec
+func (s *Spec) ValidateMTI(t MTI) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	if s.Version != 0 && t.Version() != s.Version {
+		return fmt.Errorf("%w: version %d, want %d", ErrBadMTI, t.Version(), s.Version)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// SpecVersion is the JSON spec format version understood by LoadSpec
+const SpecVersion = 1
+
+// JSON spec file layout
+//
+//	{
+//	  "version": 1,
+//	  "name": "acme",
+//	  "fields": [
+//	    {"number": 0, "name": "Message Type Indicator", "type": "n", "length": "fixed", "max": 4},
+//	    {"number": 1, "name": "Bitmap", "type": "b", "length": "fixed", "max": 16, "encoding": "hex"},
+//	    {"number": 2, "name": "Primary Account Number", "type": "n", "length": "LL", "max": 19,
+//	     "encoding": "bcd", "lengthEncoding": "bcd"},
+//	    {"number": 39, "name": "Response Code", "type": "an", "length": "fixed", "max": 2, "padding": "right"}
+//	  ]
+//	}
+type jsonSpec struct {
+	Version int         `json:"version"`
+	Name    string      `json:"name"`
+	Fields  []jsonField `json:"fields"`
+}
+
+type jsonField struct {
+	Number         uint   `json:"number"`
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	Length         string `json:"length"` // fixed, LL, LLL or LLLL
+	Max            int    `json:"max"`
+	Padding        string `json:"padding"` // left (default) or right, fixed fields only
+	Encoding       string `json:"encoding"`
+	LengthEncoding string `json:"lengthEncoding"`
+}
+
+var specTypes = map[string]bool{
+	"n": true, "a": true, "s": true, "an": true, "as": true, "ns": true, "ans": true, "b": true, "z": true,
+}
+
+// maximum value length per length kind
+var specLengths = map[string]int{
+	"fixed": 999,
+	"LL":    99,
+	"LLL":   999,
+	"LLLL":  9999,
+}
+
+var specEncoders = map[string]Encoder{
+	"ascii":       ASCII,
+	"binary":      Binary,
+	"bcd":         BCD,
+	"bcd-right":   RightBCD,
+	"bcd-right-f": RightBCDF,
+	"ebcdic":      EBCDIC,
+	"cp037":       CP037,
+	"cp1047":      CP1047,
+}
+
+var specBitmaps = map[string]BitmapEncoding{
+	"binary":     BitmapBinary,
+	"hex":        BitmapHex,
+	"ebcdic-hex": BitmapEBCDICHex,
+}
+
+// LoadSpec reads and validates a spec in the JSON spec format. The MTI
+// and the bitmap are the only required fields. Data fields may be left
+// out of a spec, so gaps between them are allowed: messages carrying a
+// field the spec does not define fail with ErrNoField, and the fields a
+// message must carry are checked by a RuleSet.
+func LoadSpec(r io.Reader) (*Spec, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var js jsonSpec
+	if err := dec.Decode(&js); err != nil {
+		return nil, fmt.Errorf("iso8583: spec: %v", err)
+	}
+	if js.Version != SpecVersion {
+		return nil, fmt.Errorf("iso8583: spec: unsupported version %d", js.Version)
+	}
+
+	spec := NewSpec(js.Name)
+	var seen [MaxField + 1]bool
+	for _, f := range js.Fields {
+		if f.Number > MaxField {
+			return nil, fmt.Errorf("iso8583: spec: field %d out of range", f.Number)
+		}
+		if seen[f.Number] {
+			return nil, fmt.Errorf("iso8583: spec: field %d defined twice", f.Number)
+		}
+		seen[f.Number] = true
+
+		if err := spec.addJSONField(f); err != nil {
+			return nil, fmt.Errorf("iso8583: spec: field %d: %v", f.Number, err)
+		}
+	}
+
+	// MTI and bitmap are required
+	for no := uint(0); no < 2; no++ {
+		if !seen[no] {
+			return nil, fmt.Errorf("iso8583: spec: field %d (%s) is missing", no, isoNames[no])
+		}
+	}
+
+	return spec, nil
+}
+
+// LoadSpecFile reads a JSON spec file
+func LoadSpecFile(name string) (*Spec, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadSpec(f)
+}
+
+// addJSONField validates f and adds it to the spec
+func (s *Spec) addJSONField(f jsonField) error {
+	if !specTypes[f.Type] {
+		return fmt.Errorf("unknown type %q", f.Type)
+	}
+	max, ok := specLengths[f.Length]
+	if !ok {
+		return fmt.Errorf("unknown length kind %q", f.Length)
+	}
+	if f.Max < 1 || f.Max > max {
+		return fmt.Errorf("max length %d outside 1..%d", f.Max, max)
+	}
+	if f.Padding != "" && f.Padding != "left" && f.Padding != "right" {
+		return fmt.Errorf("unknown padding %q", f.Padding)
+	}
+	if f.Padding != "" && f.Length != "fixed" {
+		return fmt.Errorf("padding applies to fixed fields only")
+	}
+	s.Names[f.Number] = f.Name
+
+	if f.Number == 1 {
+		if f.Length != "fixed" {
+			return fmt.Errorf("bitmap must be fixed")
+		}
+		enc, ok := specBitmaps[orDefault(f.Encoding, "binary")]
+		if !ok {
+			return fmt.Errorf("unknown bitmap encoding %q", f.Encoding)
+		}
+		// one 64 bit bitmap in bytes or hex digits
+		size := 8
+		if enc != BitmapBinary {
+			size = 16
+		}
+		if f.Max != size {
+			return fmt.Errorf("bitmap max %d, want %d for %s encoding", f.Max, size, orDefault(f.Encoding, "binary"))
+		}
+		s.Bitmap = enc
+		return nil
+	}
+
+	enc, ok := specEncoders[orDefault(f.Encoding, "ascii")]
+	if !ok {
+		return fmt.Errorf("unknown encoding %q", f.Encoding)
+	}
+	if _, bcd := enc.(bcdEncoder); bcd && f.Type != "n" && f.Type != "z" {
+		return fmt.Errorf("BCD encoding needs type n or z, got %q", f.Type)
+	}
+	lenEnc, ok := specEncoders[orDefault(f.LengthEncoding, "ascii")]
+	if !ok {
+		return fmt.Errorf("unknown length encoding %q", f.LengthEncoding)
+	}
+	if f.LengthEncoding != "" && f.Length == "fixed" {
+		return fmt.Errorf("length encoding applies to variable fields only")
+	}
+
+	if f.Number == 0 {
+		if f.Length != "fixed" || f.Max != 4 {
+			return fmt.Errorf("MTI must be fixed with 4 digits")
+		}
+		s.MtiEnc = enc
+		return nil
+	}
+
+	typ := f.Type + strings.Repeat(".", len(f.Length))
+	switch f.Length {
+	case "fixed":
+		s.SetField(f.Number, &Field{Type: f.Type, Length: f.Max, Enc: enc, PadRight: f.Padding == "right"})
+	case "LL":
+		s.SetField(f.Number, &LLField{Type: typ, Length: f.Max, Enc: enc, LenEnc: lenEnc})
+	case "LLL":
+		s.SetField(f.Number, &LLLField{Type: typ, Length: f.Max, Enc: enc, LenEnc: lenEnc})
+	case "LLLL":
+		s.SetField(f.Number, &LLLLField{Type: typ, Length: f.Max, Enc: enc, LenEnc: lenEnc})
+	}
+	return nil
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
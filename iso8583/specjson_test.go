@@ -0,0 +1,96 @@
+package iso8583
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const jsonSample = `{
+  "version": 1,
+  "name": "acme",
+  "fields": [
+    {"number": 0, "name": "MTI", "type": "n", "length": "fixed", "max": 4},
+    {"number": 1, "name": "Bitmap", "type": "b", "length": "fixed", "max": 16, "encoding": "hex"},
+    {"number": 2, "name": "PAN", "type": "n", "length": "LL", "max": 19, "encoding": "bcd", "lengthEncoding": "bcd"},
+    {"number": 4, "name": "Amount", "type": "n", "length": "fixed", "max": 12},
+    {"number": 39, "name": "Response Code", "type": "an", "length": "fixed", "max": 2, "padding": "right"},
+    {"number": 48, "type": "ans", "length": "LLLL", "max": 2000},
+    {"number": 52, "name": "PIN Block", "type": "b", "length": "fixed", "max": 8, "encoding": "binary"}
+  ]
+}`
+
+func TestLoadSpec(t *testing.T) {
+	spec, err := LoadSpec(strings.NewReader(jsonSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Name != "acme" || spec.Bitmap != BitmapHex {
+		t.Errorf("got name %q, bitmap %d", spec.Name, spec.Bitmap)
+	}
+	if spec.FieldName(39) != "Response Code" || spec.FieldName(48) != "Additional Data - Private" {
+		t.Errorf("got names %q, %q", spec.FieldName(39), spec.FieldName(48))
+	}
+
+	msg := new(Iso8583Message)
+	msg.Mti = "0210"
+	msg.Set(CardNo, "4111111111111111")
+	msg.Set(AMOUNT, "100")
+	msg.Set(ResponseCode, "0")
+	msg.Set(AdditionalData, strings.Repeat("x", 1500))
+	msg.Set(PinData, "\x00\x11\x22\x33\x44\x55\x66\x77")
+
+	var buf bytes.Buffer
+	if err := msg.Serialize(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("0 1500xxx")) {
+		t.Error("right padded field 39 or LLLL field 48 not found")
+	}
+	got := new(Iso8583Message)
+	if err := got.Parse(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Error("message differs after round trip")
+	}
+}
+
+func TestLoadSpecValidation(t *testing.T) {
+	header := `{"number": 0, "type": "n", "length": "fixed", "max": 4},
+		{"number": 1, "type": "b", "length": "fixed", "max": 8},`
+
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"version", `{"version": 2, "fields": []}`},
+		{"unknown key", `{"version": 1, "fields": [], "extra": true}`},
+		{"no bitmap", `{"version": 1, "fields": [{"number": 0, "type": "n", "length": "fixed", "max": 4}]}`},
+		{"no mti", `{"version": 1, "fields": [{"number": 1, "type": "b", "length": "fixed", "max": 8}]}`},
+		{"duplicate", `{"version": 1, "fields": [` + header + `{"number": 1, "type": "b", "length": "fixed", "max": 8}]}`},
+		{"range", `{"version": 1, "fields": [` + header + `{"number": 193, "type": "n", "length": "fixed", "max": 4}]}`},
+		{"type", `{"version": 1, "fields": [` + header + `{"number": 2, "type": "x", "length": "LL", "max": 19}]}`},
+		{"kind", `{"version": 1, "fields": [` + header + `{"number": 2, "type": "n", "length": "L", "max": 19}]}`},
+		{"too long", `{"version": 1, "fields": [` + header + `{"number": 2, "type": "n", "length": "LL", "max": 100}]}`},
+		{"zero", `{"version": 1, "fields": [` + header + `{"number": 3, "type": "n", "length": "fixed", "max": 0}]}`},
+		{"encoding", `{"version": 1, "fields": [` + header + `{"number": 3, "type": "n", "length": "fixed", "max": 6, "encoding": "utf16"}]}`},
+		{"bcd alpha", `{"version": 1, "fields": [` + header + `{"number": 41, "type": "ans", "length": "fixed", "max": 8, "encoding": "bcd"}]}`},
+		{"padding", `{"version": 1, "fields": [` + header + `{"number": 2, "type": "n", "length": "LL", "max": 19, "padding": "right"}]}`},
+		{"bitmap", `{"version": 1, "fields": [{"number": 0, "type": "n", "length": "fixed", "max": 4},
+			{"number": 1, "type": "b", "length": "fixed", "max": 8, "encoding": "base64"}]}`},
+		{"bitmap size", `{"version": 1, "fields": [{"number": 0, "type": "n", "length": "fixed", "max": 4},
+			{"number": 1, "type": "b", "length": "fixed", "max": 3, "encoding": "hex"}]}`},
+		{"binary bitmap size", `{"version": 1, "fields": [{"number": 0, "type": "n", "length": "fixed", "max": 4},
+			{"number": 1, "type": "b", "length": "fixed", "max": 16}]}`},
+		{"mti", `{"version": 1, "fields": [{"number": 0, "type": "n", "length": "fixed", "max": 6},
+			{"number": 1, "type": "b", "length": "fixed", "max": 8}]}`},
+	}
+
+	for _, tt := range tests {
+		if _, err := LoadSpec(strings.NewReader(tt.spec)); err == nil {
+			t.Errorf("%s: invalid spec was accepted", tt.name)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrBadTrack is returned for track data that does not follow ISO 7813
+var ErrBadTrack = errors.New("iso8583: bad track data")
+
+// Track2 is magnetic stripe track 2 data as carried in field 35,
+// without start/end sentinels and LRC:
+//
+//	PAN '=' YYMM service-code discretionary-data
+type Track2 struct {
+	PAN           string
+	Expiry        string // YYMM
+	ServiceCode   string
+	Discretionary string
+}
+
+// Track1 is magnetic stripe track 1 data as carried in field 45,
+// without start/end sentinels and LRC:
+//
+//	'B' PAN '^' NAME '^' YYMM service-code discretionary-data
+type Track1 struct {
+	FormatCode    string
+	PAN           string
+	Name          string
+	Expiry        string // YYMM
+	ServiceCode   string
+	Discretionary string
+}
+
+// ParseTrack2 splits track 2 data. Both '=' and 'D' are accepted as
+// field separator.
+func ParseTrack2(s string) (*Track2, error) {
+	i := strings.IndexAny(s, "=D")
+	if i < 0 {
+		return nil, ErrBadTrack
+	}
+	t := &Track2{PAN: s[:i]}
+	rest := s[i+1:]
+	if !validPAN(t.PAN) || len(rest) < 7 || !allDigits(rest) {
+		return nil, ErrBadTrack
+	}
+	t.Expiry, t.ServiceCode, t.Discretionary = rest[:4], rest[4:7], rest[7:]
+	if !validExpiry(t.Expiry) {
+		return nil, ErrBadTrack
+	}
+	return t, nil
+}
+
+// String builds the track 2 string with '=' as separator
+func (t *Track2) String() string {
+	return t.PAN + "=" + t.Expiry + t.ServiceCode + t.Discretionary
+}
+
+// Validate checks the parts of the track before it is built
+func (t *Track2) Validate() error {
+	if !validPAN(t.PAN) || !validExpiry(t.Expiry) || len(t.ServiceCode) != 3 ||
+		!allDigits(t.ServiceCode) || !allDigits(t.Discretionary) {
+		return ErrBadTrack
+	}
+	return nil
+}
+
+// ParseTrack1 splits track 1 data
+func ParseTrack1(s string) (*Track1, error) {
+	parts := strings.SplitN(s, "^", 3)
+	if len(parts) != 3 || len(parts[0]) < 2 || len(parts[2]) < 7 {
+		return nil, ErrBadTrack
+	}
+	t := &Track1{
+		FormatCode:    parts[0][:1],
+		PAN:           parts[0][1:],
+		Name:          parts[1],
+		Expiry:        parts[2][:4],
+		ServiceCode:   parts[2][4:7],
+		Discretionary: parts[2][7:],
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// String builds the track 1 string
+func (t *Track1) String() string {
+	return t.FormatCode + t.PAN + "^" + t.Name + "^" + t.Expiry + t.ServiceCode + t.Discretionary
+}
+
+// Validate checks the parts of the track before it is built
+func (t *Track1) Validate() error {
+	if t.FormatCode != "B" || !validPAN(t.PAN) || len(t.Name) < 2 || len(t.Name) > 26 ||
+		!validExpiry(t.Expiry) || len(t.ServiceCode) != 3 || !allDigits(t.ServiceCode) {
+		return ErrBadTrack
+	}
+	for _, part := range []string{t.Name, t.Discretionary} {
+		for i := 0; i < len(part); i++ {
+			// '%', '^' and '?' are sentinels and separators
+			if c := part[i]; c < ' ' || c > '_' || c == '%' || c == '^' || c == '?' {
+				return ErrBadTrack
+			}
+		}
+	}
+	return nil
+}
+
+// Track2 parses field 35 of the message
+func (m *Iso8583Message) Track2() (*Track2, error) {
+	return ParseTrack2(m.Get(DATA2))
+}
+
+// Track1 parses field 45 of the message
+func (m *Iso8583Message) Track1() (*Track1, error) {
+	return ParseTrack1(m.Get(DATA1))
+}
+
+func validPAN(pan string) bool {
+	return len(pan) >= 12 && len(pan) <= 19 && allDigits(pan)
+}
+
+func validExpiry(yymm string) bool {
+	return len(yymm) == 4 && allDigits(yymm) && yymm[2:] >= "01" && yymm[2:] <= "12"
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
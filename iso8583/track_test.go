@@ -0,0 +1,66 @@
+package iso8583
+
+import "testing"
+
+func TestTrack2(t *testing.T) {
+	tr, err := ParseTrack2("4111111111111111D25121011234567890")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.PAN != "4111111111111111" || tr.Expiry != "2512" || tr.ServiceCode != "101" || tr.Discretionary != "1234567890" {
+		t.Errorf("got %+v", tr)
+	}
+	if tr.String() != "4111111111111111=25121011234567890" {
+		t.Errorf("got %q", tr.String())
+	}
+
+	msg := new(Iso8583Message)
+	msg.Set(DATA2, tr.String())
+	if got, err := msg.Track2(); err != nil || *got != *tr {
+		t.Errorf("got %+v, %v", got, err)
+	}
+
+	for _, s := range []string{
+		";4111111111111111=2512101?",
+		"4111111111111111",
+		"4111111111111111=251",
+		"4111111111111111=2513101",
+		"41111111111=2512101",
+		"4111111111111111=2512101A",
+	} {
+		if _, err := ParseTrack2(s); err != ErrBadTrack {
+			t.Errorf("%q: got %v, want %v", s, err, ErrBadTrack)
+		}
+	}
+	if err := (&Track2{PAN: "4111111111111111", Expiry: "2512", ServiceCode: "1"}).Validate(); err != ErrBadTrack {
+		t.Errorf("short service code: got %v", err)
+	}
+}
+
+func TestTrack1(t *testing.T) {
+	s := "B4111111111111111^DOE/JOHN^2512101000000123000000"
+	tr, err := ParseTrack1(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.PAN != "4111111111111111" || tr.Name != "DOE/JOHN" || tr.Expiry != "2512" ||
+		tr.ServiceCode != "101" || tr.Discretionary != "000000123000000" {
+		t.Errorf("got %+v", tr)
+	}
+	if tr.String() != s {
+		t.Errorf("got %q", tr.String())
+	}
+
+	for _, s := range []string{
+		"%B4111111111111111^DOE/JOHN^2512101?",
+		"A4111111111111111^DOE/JOHN^2512101",
+		"B4111111111111111^DOE/JOHN",
+		"B4111111111111111^D^2512101",
+		"B4111111111111111^DOE/JOHN^2500101",
+		"B4111111111111111^DOE/JOHN^2512101?",
+	} {
+		if _, err := ParseTrack1(s); err != ErrBadTrack {
+			t.Errorf("%q: got %v, want %v", s, err, ErrBadTrack)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2015 ubs121
+
+package iso8583
+
+import "fmt"
+
+// ValidationError reports a value that does not fit its field
+type ValidationError struct {
+	Field uint
+	Type  string
+	Err   error // ErrBadChar or ErrLengthTooLong
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("iso8583: field %d (%s): %v", e.Field, e.Type, e.Err)
+}
+
+// Unwrap returns the underlying reason
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks value against the type and max length of field no
+func (s *Spec) Validate(no uint, value string) error {
+	if no == 0 {
+		return nil
+	}
+	typ, length, enc, ok := fieldInfo(s.Field(no))
+	if !ok {
+		return &FieldError{no, 0, ErrNoField}
+	}
+
+	if charLen(enc, value) > length {
+		return &ValidationError{no, typ, ErrLengthTooLong}
+	}
+	if !validChars(typ, value) {
+		return &ValidationError{no, typ, ErrBadChar}
+	}
+	return nil
+}
+
+// Set validates value in strict mode and sets field no of m
+func (s *Spec) Set(m *Iso8583Message, no uint, value string) error {
+	if s.Strict {
+		if err := s.Validate(no, value); err != nil {
+			return err
+		}
+	}
+	m.Set(no, value)
+	return nil
+}
+
+// fieldInfo returns the type (without length dots), max length and
+// value encoding of a field definition
+func fieldInfo(f IField) (typ string, length int, enc Encoder, ok bool) {
+	switch f := f.(type) {
+	case *Field:
+		typ, length, enc = f.Type, f.Length, f.Enc
+	case *LLField:
+		typ, length, enc = f.Type, f.Length, f.Enc
+	case *LLLField:
+		typ, length, enc = f.Type, f.Length, f.Enc
+	case *LLLLField:
+		typ, length, enc = f.Type, f.Length, f.Enc
+	case *CompositeField:
+		return fieldInfo(f.Outer)
+	default:
+		return "", 0, nil, false
+	}
+	for len(typ) > 0 && typ[len(typ)-1] == '.' {
+		typ = typ[:len(typ)-1]
+	}
+	return typ, length, orASCII(enc), true
+}
+
+// validChars checks the characters of s against an ISO 8583 type
+// made of the classes a (alpha), n (numeric) and s (special), or one of
+// the types b (binary) and z (track 2/3 code set)
+func validChars(typ, s string) bool {
+	switch typ {
+	case "b":
+		return true
+	case "z":
+		for _, c := range s {
+			if !isDigit(c) && c != '=' && c != 'D' {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, c := range s {
+		switch {
+		case isDigit(c):
+			if !hasClass(typ, 'n') {
+				return false
+			}
+		case isAlpha(c) || c == ' ':
+			if !hasClass(typ, 'a') {
+				return false
+			}
+		case c > ' ' && c != 0x7F && (c < 0x80 || c > 0x9F):
+			// printable
+			if !hasClass(typ, 's') {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func hasClass(typ string, class byte) bool {
+	for i := 0; i < len(typ); i++ {
+		if typ[i] == class {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigit(c rune) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isAlpha(c rune) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z'
+}
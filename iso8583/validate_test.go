@@ -0,0 +1,86 @@
+package iso8583
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	spec := DefaultSpec()
+
+	tests := []struct {
+		no    uint
+		value string
+		err   error
+	}{
+		{AMOUNT, "000000001500", nil},
+		{AMOUNT, "15.00", ErrBadChar},
+		{AMOUNT, "1234567890123", ErrLengthTooLong},
+		{CardNo, "4111111111111111", nil},
+		{CardNo, "4111-1111", ErrBadChar},
+		{DATA2, "4111111111111111=25121010000000000", nil},
+		{DATA2, "4111111111111111^2512", ErrBadChar},
+		{RefNo, "ABC123 ", nil},
+		{RefNo, "ABC-123", ErrBadChar},
+		{TERMINAL, "T-01/A", nil},
+		{TERMINAL, "T\x0001", ErrBadChar},
+		{DESC, "Café Zürich", nil},
+	}
+
+	for _, tt := range tests {
+		err := spec.Validate(tt.no, tt.value)
+		if tt.err == nil {
+			if err != nil {
+				t.Errorf("field %d %q: %v", tt.no, tt.value, err)
+			}
+			continue
+		}
+		var ve *ValidationError
+		if !errors.As(err, &ve) || ve.Field != tt.no || ve.Err != tt.err {
+			t.Errorf("field %d %q: got %v, want %v", tt.no, tt.value, err, tt.err)
+		}
+	}
+}
+
+func TestStrictMode(t *testing.T) {
+	spec := DefaultSpec()
+	msg := sampleMessage()
+	msg.Set(TERMINAL, "TERMINAL01")
+
+	// lenient mode truncates
+	var buf bytes.Buffer
+	if err := msg.Serialize(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	got := new(Iso8583Message)
+	if err := got.Parse(spec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get(TERMINAL) != "TERMINAL" {
+		t.Errorf("got %q, want truncated value", got.Get(TERMINAL))
+	}
+	if err := spec.Set(msg, AMOUNT, "1x"); err != nil || msg.Get(AMOUNT) != "1x" {
+		t.Errorf("lenient Set: %v", err)
+	}
+
+	spec.Strict = true
+	err := msg.Serialize(spec, &buf)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || ve.Field != AMOUNT || ve.Err != ErrBadChar {
+		t.Errorf("got %v, want field 4: %v", err, ErrBadChar)
+	}
+
+	msg.Set(AMOUNT, "100")
+	err = msg.Serialize(spec, &buf)
+	if !errors.As(err, &ve) || ve.Field != TERMINAL || ve.Err != ErrLengthTooLong {
+		t.Errorf("got %v, want field 41: %v", err, ErrLengthTooLong)
+	}
+
+	if err := spec.Set(msg, TraceNo, "12a"); !errors.As(err, &ve) || ve.Field != TraceNo {
+		t.Errorf("strict Set: got %v", err)
+	}
+	if msg.Get(TraceNo) != "123" {
+		t.Errorf("rejected value was stored: %q", msg.Get(TraceNo))
+	}
+}